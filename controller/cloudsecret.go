@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/v1alpha1"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/sink/kubernetes"
+	"github.com/kvendingoldo/cloud-secrets/store"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// CloudSecretReconciler synchronizes CloudSecret resources into Kubernetes Secrets.
+// In operator mode it replaces the Controller: every CloudSecret is synchronized on its own refresh interval.
+type CloudSecretReconciler struct {
+	client.Client
+
+	// Providers by name, referenced by the providerRef of CloudSecrets
+	Providers map[string]provider.Provider
+	// DefaultProvider is the name of the provider used by CloudSecrets without providerRef
+	DefaultProvider string
+	// ProviderNamespaces are the namespaces whose CloudSecrets may use Providers, which hold the credentials
+	// of the operator. CloudSecrets in other namespaces have to reference a store.
+	ProviderNamespaces []string
+	// Stores instantiates the providers of SecretStores and ClusterSecretStores referenced by CloudSecrets
+	Stores *store.Manager
+
+	// Interval is the refresh interval of CloudSecrets which don't specify one
+	Interval time.Duration
+}
+
+// SetupWithManager registers the reconciler, it is triggered by spec changes of CloudSecrets
+// and changes of the owned Secrets, so modified or deleted Secrets are restored.
+// If stores are enabled, spec changes of stores trigger the CloudSecrets referencing them.
+func (r *CloudSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	b := ctrl.NewControllerManagedBy(mgr).
+		// Status updates don't change the generation, so they don't trigger another reconciliation
+		For(&v1alpha1.CloudSecret{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Owns(&corev1.Secret{})
+	if r.Stores != nil {
+		b = b.
+			Watches(&v1alpha1.SecretStore{}, handler.EnqueueRequestsFromMapFunc(r.referencingCloudSecrets),
+				builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+			Watches(&v1alpha1.ClusterSecretStore{}, handler.EnqueueRequestsFromMapFunc(r.referencingCloudSecrets),
+				builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	}
+	return b.Complete(r)
+}
+
+// referencingCloudSecrets returns the CloudSecrets referencing store, a SecretStore or ClusterSecretStore
+func (r *CloudSecretReconciler) referencingCloudSecrets(ctx context.Context, store client.Object) []reconcile.Request {
+	kind := v1alpha1.SecretStoreKind
+	var opts []client.ListOption
+	if _, ok := store.(*v1alpha1.ClusterSecretStore); ok {
+		kind = v1alpha1.ClusterSecretStoreKind
+	} else {
+		opts = append(opts, client.InNamespace(store.GetNamespace()))
+	}
+
+	var list v1alpha1.CloudSecretList
+	if err := r.List(ctx, &list, opts...); err != nil {
+		log.Errorf("Failed to list CloudSecrets of %s %s: %v", kind, store.GetName(), err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cs := range list.Items {
+		if cs.Spec.ProviderRef.Kind == kind && cs.Spec.ProviderRef.Name == store.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cs)})
+		}
+	}
+	return requests
+}
+
+// +kubebuilder:rbac:groups=cloud-secrets.kvendingoldo.io,resources=cloudsecrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cloud-secrets.kvendingoldo.io,resources=cloudsecrets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
+
+func (r *CloudSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var cs v1alpha1.CloudSecret
+	if err := r.Get(ctx, req.NamespacedName, &cs); err != nil {
+		if apierrors.IsNotFound(err) {
+			deleteOperatorMetrics(req.Namespace, req.Name)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	syncAttemptsTotal.Inc()
+	version, syncErr := r.sync(ctx, &cs)
+
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             v1alpha1.ReasonSynced,
+		Message:            "Secret is in sync",
+		ObservedGeneration: cs.Generation,
+	}
+	if syncErr != nil {
+		syncFailuresTotal.Inc()
+		log.Errorf("Failed to sync CloudSecret %s: %v", req.NamespacedName, syncErr)
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = v1alpha1.ReasonSyncFailed
+		condition.Message = syncErr.Error()
+	} else {
+		now := metav1.Now()
+		cs.Status.LastSyncTime = &now
+		cs.Status.SyncedVersion = version
+		log.Infof("Synced CloudSecret %s (version: %s)", req.NamespacedName, version)
+	}
+	cs.Status.ObservedGeneration = cs.Generation
+	meta.SetStatusCondition(&cs.Status.Conditions, condition)
+
+	if err := r.Status().Update(ctx, &cs); err != nil {
+		return ctrl.Result{}, err
+	}
+	// Failed synchronizations are retried with backoff
+	if syncErr != nil {
+		return ctrl.Result{}, syncErr
+	}
+
+	interval := r.Interval
+	if cs.Spec.RefreshInterval != nil {
+		interval = cs.Spec.RefreshInterval.Duration
+	}
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// sync fetches the remote secrets of cs and writes them into the target Secret.
+// It returns the versions of the remote secrets, separated by commas.
+func (r *CloudSecretReconciler) sync(ctx context.Context, cs *v1alpha1.CloudSecret) (string, error) {
+	p, providerName, err := r.provider(ctx, cs)
+	if err != nil {
+		return "", err
+	}
+
+	data := map[string][]byte{}
+	var versions []string
+	for _, ref := range cs.Spec.Data {
+		start := time.Now()
+		secret, err := provider.GetSecretVersion(ctx, p, ref.Name, ref.Version)
+		operatorFetchDuration.WithLabelValues(cs.Namespace, cs.Name, ref.Name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			operatorFetchFailuresTotal.WithLabelValues(cs.Namespace, cs.Name, ref.Name, provider.ErrorCode(err)).Inc()
+			return "", err
+		}
+		if err := addSecretData(data, ref, secret); err != nil {
+			return "", err
+		}
+		versions = append(versions, secret.Version)
+
+		operatorLastSyncTimestamp.WithLabelValues(cs.Namespace, cs.Name, ref.Name).Set(float64(time.Now().Unix()))
+		if !secret.CreatedAt.IsZero() {
+			operatorSecretAge.WithLabelValues(cs.Namespace, cs.Name, ref.Name).Set(time.Since(secret.CreatedAt).Seconds())
+		}
+	}
+	version := strings.Join(versions, ",")
+
+	name := cs.Spec.Target.Name
+	if name == "" {
+		name = cs.Name
+	}
+	target := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cs.Namespace,
+		},
+	}
+	template := cs.Spec.Target.Template
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, target, func() error {
+		// Existing Secrets are only taken over if they were created for this CloudSecret,
+		// otherwise their data would be replaced and they would be deleted together with it
+		if target.ResourceVersion != "" && !metav1.IsControlledBy(target, cs) {
+			return fmt.Errorf("secret %s exists and is not managed by this CloudSecret", name)
+		}
+
+		// The type of a Secret is immutable
+		if target.ResourceVersion == "" {
+			target.Type = corev1.SecretTypeOpaque
+			if template.Type != "" {
+				target.Type = template.Type
+			}
+		}
+
+		if target.Labels == nil {
+			target.Labels = map[string]string{}
+		}
+		for k, v := range template.Labels {
+			target.Labels[k] = v
+		}
+		target.Labels["app.kubernetes.io/managed-by"] = kubernetes.FieldManager
+
+		if target.Annotations == nil {
+			target.Annotations = map[string]string{}
+		}
+		for k, v := range template.Annotations {
+			target.Annotations[k] = v
+		}
+		target.Annotations[kubernetes.AnnotationProvider] = providerName
+		target.Annotations[kubernetes.AnnotationVersion] = version
+
+		target.Data = data
+
+		// The Secret is garbage collected together with the CloudSecret
+		return controllerutil.SetControllerReference(cs, target, r.Scheme())
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to write secret %s: %w", name, err)
+	}
+
+	if err := r.deleteStaleSecrets(ctx, cs, name); err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+// deleteStaleSecrets deletes the Secrets of cs other than the target Secret name,
+// which were written before the target name changed.
+func (r *CloudSecretReconciler) deleteStaleSecrets(ctx context.Context, cs *v1alpha1.CloudSecret, name string) error {
+	var list corev1.SecretList
+	err := r.List(ctx, &list, client.InNamespace(cs.Namespace),
+		client.MatchingLabels{"app.kubernetes.io/managed-by": kubernetes.FieldManager})
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	for i := range list.Items {
+		secret := &list.Items[i]
+		if secret.Name == name || !metav1.IsControlledBy(secret, cs) {
+			continue
+		}
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete secret %s: %w", secret.Name, err)
+		}
+		log.Infof("Deleted secret %s/%s, the target of CloudSecret %s changed to %s", secret.Namespace, secret.Name, cs.Name, name)
+	}
+
+	return nil
+}
+
+// provider returns the provider referenced by cs and its name, e.g. "aws" or "SecretStore/prod"
+func (r *CloudSecretReconciler) provider(ctx context.Context, cs *v1alpha1.CloudSecret) (provider.Provider, string, error) {
+	ref := cs.Spec.ProviderRef
+	if ref.Kind != "" {
+		if r.Stores == nil {
+			return nil, "", fmt.Errorf("%s %s can't be used, stores are disabled", ref.Kind, ref.Name)
+		}
+		p, err := r.Stores.Provider(ctx, cs.Namespace, ref)
+		return p, ref.Kind + "/" + ref.Name, err
+	}
+
+	if !r.providerNamespace(cs.Namespace) {
+		return nil, "", fmt.Errorf("CloudSecrets in namespace %s have to reference a SecretStore or ClusterSecretStore", cs.Namespace)
+	}
+	name := ref.Name
+	if name == "" {
+		name = r.DefaultProvider
+	}
+	p, ok := r.Providers[name]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown provider %s", name)
+	}
+	return p, name, nil
+}
+
+// providerNamespace reports whether CloudSecrets in namespace may use Providers
+func (r *CloudSecretReconciler) providerNamespace(namespace string) bool {
+	for _, ns := range r.ProviderNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// addSecretData adds the keys of secret selected by ref to data. Keys taken from names are mapped to valid
+// data keys, keys specified by secretKey have to be valid already.
+// It returns an error if a key is already set, e.g. by another entry of the same CloudSecret.
+func addSecretData(data map[string][]byte, ref v1alpha1.RemoteSecret, secret *provider.Secret) error {
+	entry, err := secretData(ref, secret)
+	if err != nil {
+		return err
+	}
+	for k, v := range entry {
+		if _, ok := data[k]; ok {
+			return fmt.Errorf("key %s of secret %s is already set by another data entry", k, ref.Name)
+		}
+		data[k] = v
+	}
+	return nil
+}
+
+// secretData returns the keys of secret selected by ref
+func secretData(ref v1alpha1.RemoteSecret, secret *provider.Secret) (map[string][]byte, error) {
+	if ref.Key != "" {
+		kv, ok := secret.KeyValues()
+		if !ok {
+			return nil, fmt.Errorf("secret %s is not a JSON object, unable to select key %s", ref.Name, ref.Key)
+		}
+		value, ok := kv[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+		}
+
+		key := ref.SecretKey
+		if key == "" {
+			var err error
+			if key, err = kubernetes.DataKey(ref.Key); err != nil {
+				return nil, fmt.Errorf("invalid key of secret %s: %w", ref.Name, err)
+			}
+		}
+		return map[string][]byte{key: []byte(value)}, nil
+	}
+
+	if ref.SecretKey != "" {
+		return map[string][]byte{ref.SecretKey: secret.Value}, nil
+	}
+
+	if kv, ok := secret.KeyValues(); ok {
+		data := map[string][]byte{}
+		if err := kubernetes.AddKeyValues(data, ref.Name, kv); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	key, err := kubernetes.DataKey(ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{key: secret.Value}, nil
+}
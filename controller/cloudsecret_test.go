@@ -0,0 +1,396 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kvendingoldo/cloud-secrets/internal/fixtures"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/v1alpha1"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/sink/kubernetes"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestReconciler(t *testing.T, p provider.Provider, objects ...client.Object) *CloudSecretReconciler {
+	t.Helper()
+	c := fixtures.NewClientBuilder(t).
+		WithObjects(objects...).
+		WithStatusSubresource(&v1alpha1.CloudSecret{}).
+		Build()
+	return &CloudSecretReconciler{
+		Client:             c,
+		Providers:          map[string]provider.Provider{"fake": p},
+		DefaultProvider:    "fake",
+		ProviderNamespaces: []string{"apps", "other"},
+		Interval:           time.Minute,
+	}
+}
+
+func newCloudSecret(name string, data ...v1alpha1.RemoteSecret) *v1alpha1.CloudSecret {
+	return &v1alpha1.CloudSecret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps", UID: types.UID("uid-" + name), Generation: 1},
+		Spec:       v1alpha1.CloudSecretSpec{Data: data},
+	}
+}
+
+func reconcileCloudSecret(t *testing.T, r *CloudSecretReconciler, name string) (ctrl.Result, error) {
+	t.Helper()
+	return r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "apps", Name: name}})
+}
+
+func TestReconcile(t *testing.T) {
+	p := newFakeProvider(map[string]string{
+		"prod/db":  `{"user":"app","db/password":"hunter2"}`,
+		"prod/api": "token",
+	})
+	cs := newCloudSecret("app",
+		v1alpha1.RemoteSecret{Name: "prod/db"},
+		v1alpha1.RemoteSecret{Name: "prod/api"},
+		v1alpha1.RemoteSecret{Name: "prod/db", Key: "user", SecretKey: "username"},
+	)
+	cs.Spec.Target.Template.Labels = map[string]string{"team": "a"}
+	cs.Spec.RefreshInterval = &metav1.Duration{Duration: 5 * time.Minute}
+	r := newTestReconciler(t, p, cs)
+
+	result, err := reconcileCloudSecret(t, r, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != 5*time.Minute {
+		t.Errorf("requeue after = %v", result.RequeueAfter)
+	}
+
+	var secret corev1.Secret
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "app"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"user": "app", "db_password": "hunter2", "prod_api": "token", "username": "app"}
+	got := map[string]string{}
+	for k, v := range secret.Data {
+		got[k] = string(v)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("data = %v, want %v", got, want)
+	}
+	if secret.Labels["team"] != "a" || secret.Labels["app.kubernetes.io/managed-by"] != kubernetes.FieldManager {
+		t.Errorf("labels = %v", secret.Labels)
+	}
+	if secret.Annotations[kubernetes.AnnotationProvider] != "fake" || secret.Annotations[kubernetes.AnnotationVersion] != "1,1,1" {
+		t.Errorf("annotations = %v", secret.Annotations)
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].Name != "app" {
+		t.Errorf("owner references = %v", secret.OwnerReferences)
+	}
+
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "app"}, cs); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(cs.Status.Conditions, v1alpha1.ConditionReady) {
+		t.Errorf("conditions = %v", cs.Status.Conditions)
+	}
+	if cs.Status.SyncedVersion != "1,1,1" || cs.Status.LastSyncTime == nil || cs.Status.ObservedGeneration != 1 {
+		t.Errorf("status = %+v", cs.Status)
+	}
+}
+
+func TestReconcileRefusesForeignSecret(t *testing.T) {
+	p := newFakeProvider(map[string]string{"db": "hunter2"})
+	foreign := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "apps"},
+		Data:       map[string][]byte{"tls.crt": []byte("certificate")},
+	}
+	r := newTestReconciler(t, p, newCloudSecret("app", v1alpha1.RemoteSecret{Name: "db"}), foreign)
+
+	if _, err := reconcileCloudSecret(t, r, "app"); err == nil {
+		t.Fatal("expected error for a Secret not managed by the CloudSecret")
+	}
+
+	var secret corev1.Secret
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "app"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["tls.crt"]) != "certificate" || len(secret.OwnerReferences) != 0 {
+		t.Errorf("foreign Secret was taken over: %+v", secret)
+	}
+}
+
+func TestReconcileTargetRenamed(t *testing.T) {
+	p := newFakeProvider(map[string]string{"db": "hunter2"})
+	cs := newCloudSecret("app", v1alpha1.RemoteSecret{Name: "db"})
+	cs.Spec.Target.Name = "old"
+	r := newTestReconciler(t, p, cs)
+
+	if _, err := reconcileCloudSecret(t, r, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "app"}, cs); err != nil {
+		t.Fatal(err)
+	}
+	cs.Spec.Target.Name = "new"
+	if err := r.Update(context.Background(), cs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconcileCloudSecret(t, r, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	var secret corev1.Secret
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "new"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	err := r.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "old"}, &secret)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("previous target wasn't deleted: %v", err)
+	}
+}
+
+func TestReconcileUpdatesSecret(t *testing.T) {
+	p := newFakeProvider(map[string]string{"db": "old"})
+	cs := newCloudSecret("app", v1alpha1.RemoteSecret{Name: "db", SecretKey: "password"})
+	cs.Spec.Target.Name = "db-credentials"
+	r := newTestReconciler(t, p, cs)
+
+	if _, err := reconcileCloudSecret(t, r, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.UpdateSecret(context.Background(), "db", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconcileCloudSecret(t, r, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	var secret corev1.Secret
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "apps", Name: "db-credentials"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(secret.Data["password"]); got != "new" {
+		t.Errorf("password = %q", got)
+	}
+	if secret.Annotations[kubernetes.AnnotationVersion] != "2" {
+		t.Errorf("annotations = %v", secret.Annotations)
+	}
+}
+
+func TestReconcileFailure(t *testing.T) {
+	tests := map[string]struct {
+		cs   *v1alpha1.CloudSecret
+		code string
+	}{
+		"missing secret": {
+			cs:   newCloudSecret("missing", v1alpha1.RemoteSecret{Name: "missing"}),
+			code: "404",
+		},
+		"missing key": {
+			cs: newCloudSecret("key", v1alpha1.RemoteSecret{Name: "db", Key: "password"}),
+		},
+		"colliding keys": {
+			cs: newCloudSecret("collision", v1alpha1.RemoteSecret{Name: "collision"}),
+		},
+		"unknown provider": {
+			cs: func() *v1alpha1.CloudSecret {
+				cs := newCloudSecret("provider", v1alpha1.RemoteSecret{Name: "db"})
+				cs.Spec.ProviderRef.Name = "unknown"
+				return cs
+			}(),
+		},
+		"stores disabled": {
+			cs: func() *v1alpha1.CloudSecret {
+				cs := newCloudSecret("store", v1alpha1.RemoteSecret{Name: "db"})
+				cs.Spec.ProviderRef = v1alpha1.ProviderRef{Kind: v1alpha1.SecretStoreKind, Name: "prod"}
+				return cs
+			}(),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := newFakeProvider(map[string]string{
+				"db":        `{"user":"app"}`,
+				"collision": `{"a/b":"1","a b":"2"}`,
+			})
+			r := newTestReconciler(t, p, tt.cs)
+
+			var failures float64
+			if tt.code != "" {
+				failures = testutil.ToFloat64(operatorFetchFailuresTotal.WithLabelValues("apps", tt.cs.Name, "missing", tt.code))
+			}
+
+			if _, err := reconcileCloudSecret(t, r, tt.cs.Name); err == nil {
+				t.Fatal("expected error")
+			}
+
+			var cs v1alpha1.CloudSecret
+			if err := r.Get(context.Background(), client.ObjectKeyFromObject(tt.cs), &cs); err != nil {
+				t.Fatal(err)
+			}
+			condition := meta.FindStatusCondition(cs.Status.Conditions, v1alpha1.ConditionReady)
+			if condition == nil || condition.Status != metav1.ConditionFalse || condition.Reason != v1alpha1.ReasonSyncFailed {
+				t.Errorf("condition = %+v", condition)
+			}
+
+			var secrets corev1.SecretList
+			if err := r.List(context.Background(), &secrets); err != nil {
+				t.Fatal(err)
+			}
+			if len(secrets.Items) != 0 {
+				t.Errorf("failed sync wrote %d secret(s)", len(secrets.Items))
+			}
+
+			if tt.code != "" {
+				got := testutil.ToFloat64(operatorFetchFailuresTotal.WithLabelValues("apps", tt.cs.Name, "missing", tt.code))
+				if got != failures+1 {
+					t.Errorf("fetch failures = %v, want %v", got, failures+1)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileProviderNamespace(t *testing.T) {
+	p := newFakeProvider(map[string]string{"db": "value"})
+	cs := newCloudSecret("app", v1alpha1.RemoteSecret{Name: "db"})
+	cs.Namespace = "tenant"
+	r := newTestReconciler(t, p, cs)
+
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "tenant", Name: "app"}})
+	if err == nil {
+		t.Fatal("expected error for the provider of the operator outside of the provider namespaces")
+	}
+
+	var secret corev1.Secret
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "tenant", Name: "app"}, &secret); !apierrors.IsNotFound(err) {
+		t.Errorf("secret was written: %v", err)
+	}
+}
+
+func TestReconcileDeleted(t *testing.T) {
+	cs := newCloudSecret("deleted", v1alpha1.RemoteSecret{Name: "db"})
+	r := newTestReconciler(t, newFakeProvider(map[string]string{"db": "value"}), cs)
+	if _, err := reconcileCloudSecret(t, r, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(context.Background(), cs); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := reconcileCloudSecret(t, r, "deleted")
+	if err != nil || result.RequeueAfter != 0 {
+		t.Errorf("result = %v, %v", result, err)
+	}
+	if operatorLastSyncTimestamp.DeleteLabelValues("apps", "deleted", "db") {
+		t.Error("series of the deleted CloudSecret weren't removed")
+	}
+}
+
+func TestReconcileMetricLabels(t *testing.T) {
+	p := newFakeProvider(map[string]string{"db": "value"})
+	first := newCloudSecret("first", v1alpha1.RemoteSecret{Name: "db"})
+	second := newCloudSecret("second", v1alpha1.RemoteSecret{Name: "db"})
+	second.Namespace = "other"
+	r := newTestReconciler(t, p, first, second)
+
+	if _, err := reconcileCloudSecret(t, r, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "other", Name: "second"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, labels := range [][]string{{"apps", "first", "db"}, {"other", "second", "db"}} {
+		if testutil.ToFloat64(operatorLastSyncTimestamp.WithLabelValues(labels...)) == 0 {
+			t.Errorf("no sync timestamp for %v", labels)
+		}
+	}
+}
+
+func TestAddSecretData(t *testing.T) {
+	secret := &provider.Secret{Name: "prod/db", Value: []byte(`{"db/password":"p"}`)}
+	tests := []struct {
+		ref     v1alpha1.RemoteSecret
+		want    map[string]string
+		wantErr bool
+	}{
+		{ref: v1alpha1.RemoteSecret{Name: "prod/db"}, want: map[string]string{"db_password": "p"}},
+		{ref: v1alpha1.RemoteSecret{Name: "prod/db", Key: "db/password"}, want: map[string]string{"db_password": "p"}},
+		{ref: v1alpha1.RemoteSecret{Name: "prod/db", Key: "db/password", SecretKey: "password"}, want: map[string]string{"password": "p"}},
+		{ref: v1alpha1.RemoteSecret{Name: "prod/db", SecretKey: "raw"}, want: map[string]string{"raw": `{"db/password":"p"}`}},
+		{ref: v1alpha1.RemoteSecret{Name: "prod/db", Key: "missing"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		data := map[string][]byte{}
+		err := addSecretData(data, tt.ref, secret)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v: error = %v, want error %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		got := map[string]string{}
+		for k, v := range data {
+			got[k] = string(v)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: data = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestAddSecretDataCollision(t *testing.T) {
+	data := map[string][]byte{}
+	first := v1alpha1.RemoteSecret{Name: "prod/db", Key: "password"}
+	if err := addSecretData(data, first, &provider.Secret{Name: "prod/db", Value: []byte(`{"password":"a"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	second := v1alpha1.RemoteSecret{Name: "staging/db", Key: "password"}
+	err := addSecretData(data, second, &provider.Secret{Name: "staging/db", Value: []byte(`{"password":"b"}`)})
+	if err == nil {
+		t.Fatal("expected error for a key set by another entry")
+	}
+	if string(data["password"]) != "a" {
+		t.Errorf("password = %q, the first entry was overwritten", data["password"])
+	}
+}
+
+func TestReferencingCloudSecrets(t *testing.T) {
+	storeRef := func(cs *v1alpha1.CloudSecret, kind string) *v1alpha1.CloudSecret {
+		cs.Spec.ProviderRef = v1alpha1.ProviderRef{Kind: kind, Name: "prod"}
+		return cs
+	}
+	other := storeRef(newCloudSecret("other-namespace"), v1alpha1.SecretStoreKind)
+	other.Namespace = "other"
+	r := newTestReconciler(t, newFakeProvider(nil),
+		storeRef(newCloudSecret("store"), v1alpha1.SecretStoreKind),
+		storeRef(newCloudSecret("cluster-store"), v1alpha1.ClusterSecretStoreKind),
+		newCloudSecret("default-provider"),
+		other,
+	)
+
+	tests := []struct {
+		store client.Object
+		want  []string
+	}{
+		{store: &v1alpha1.SecretStore{ObjectMeta: metav1.ObjectMeta{Name: "prod", Namespace: "apps"}}, want: []string{"apps/store"}},
+		{store: &v1alpha1.SecretStore{ObjectMeta: metav1.ObjectMeta{Name: "dev", Namespace: "apps"}}},
+		{store: &v1alpha1.ClusterSecretStore{ObjectMeta: metav1.ObjectMeta{Name: "prod"}}, want: []string{"apps/cluster-store"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, req := range r.referencingCloudSecrets(context.Background(), tt.store) {
+			got = append(got, req.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%T %s: requests = %v, want %v", tt.store, tt.store.GetName(), got, tt.want)
+		}
+	}
+}
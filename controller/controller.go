@@ -2,7 +2,12 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/kvendingoldo/cloud-secrets/hook"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
 	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/sink"
 	"sync"
 	"time"
 
@@ -12,11 +17,26 @@ import (
 // Controller is responsible for orchestrating the different components.
 type Controller struct {
 	Provider provider.Provider
+	// Sinks receive every fetched secret
+	Sinks []sink.Sink
+	// Hooks run after all sinks were written successfully
+	Hooks []hook.Hook
 
 	// The interval between individual synchronizations
 	Interval time.Duration
 
-	SecretName string
+	// The secrets to synchronize
+	Secrets []cloudsecrets.SecretSpec
+
+	// Selector discovers additional secrets on every run (optional), requires a provider.SecretLister
+	Selector *provider.Selector
+
+	// The maximum number of secrets fetched in parallel
+	Concurrency int
+
+	// State enables change detection (optional), sinks are only written if a secret changed
+	// or, for sinks implementing sink.Checker, if their output is not up to date
+	State *State
 
 	// The nextRunAt used for throttling and batching reconciliation
 	nextRunAt time.Time
@@ -26,12 +46,194 @@ type Controller struct {
 
 // RunOnce runs a single iteration of a reconciliation loop.
 func (c *Controller) RunOnce(ctx context.Context) error {
+	syncAttemptsTotal.Inc()
 
-	c.Provider.GetSecret(c.SecretName)
+	specs, secrets, err := c.sync(ctx)
+	if err != nil {
+		syncFailuresTotal.Inc()
+		return err
+	}
+
+	// Like the fetch metrics, the secrets are labeled by their name in the provider rather than their alias
+	now := time.Now()
+	for i, secret := range secrets {
+		lastSyncTimestamp.WithLabelValues(specs[i].Name).Set(float64(now.Unix()))
+		if !secret.CreatedAt.IsZero() {
+			secretAge.WithLabelValues(specs[i].Name).Set(now.Sub(secret.CreatedAt).Seconds())
+		}
+	}
 
 	return nil
 }
 
+// sync fetches all secrets and passes them to sinks and hooks.
+// Sinks are only written if all secrets were fetched successfully, so they never end up with partial data.
+// It returns the synchronized specs together with their secrets.
+func (c *Controller) sync(ctx context.Context) ([]cloudsecrets.SecretSpec, []*provider.Secret, error) {
+	specs, err := secretSpecs(ctx, c.Provider, c.Secrets, c.Selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secrets, err := c.fetchSecrets(ctx, specs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sinks := c.Sinks
+	if c.State != nil {
+		changed := c.State.Changed(secrets)
+		if len(changed) > 0 {
+			log.Infof("Changed secrets: %v", changed)
+		}
+
+		sinks, err = outdatedSinks(ctx, c.Sinks, secrets, len(changed) > 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(sinks) == 0 {
+			log.Debug("All sinks are up to date")
+			if len(changed) > 0 {
+				if err := c.State.Update(secrets); err != nil {
+					return nil, nil, err
+				}
+			}
+			return specs, secrets, nil
+		}
+	}
+
+	for _, s := range sinks {
+		if err := s.Write(ctx, secrets); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, h := range c.Hooks {
+		if err := h.Run(ctx); err != nil {
+			return nil, nil, err
+		}
+		log.Infof("Ran hook %s", h)
+	}
+
+	// The state is only updated once hooks succeeded, so failed hooks are retried on the next run
+	if c.State != nil {
+		if err := c.State.Update(secrets); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return specs, secrets, nil
+}
+
+// outdatedSinks returns the sinks which need to be written: sinks implementing sink.Checker whose output
+// is not up to date, e.g. as it was deleted, and all other sinks if a secret changed.
+func outdatedSinks(ctx context.Context, sinks []sink.Sink, secrets []*provider.Secret, changed bool) ([]sink.Sink, error) {
+	var outdated []sink.Sink
+	for _, s := range sinks {
+		checker, ok := s.(sink.Checker)
+		if !ok {
+			if changed {
+				outdated = append(outdated, s)
+			}
+			continue
+		}
+
+		upToDate, err := checker.UpToDate(ctx, secrets)
+		if err != nil {
+			return nil, err
+		}
+		if !upToDate {
+			outdated = append(outdated, s)
+		}
+	}
+
+	return outdated, nil
+}
+
+// secretSpecs returns the configured secrets extended with the secrets of p discovered by the selector (optional).
+func secretSpecs(ctx context.Context, p provider.Provider, secrets []cloudsecrets.SecretSpec, selector *provider.Selector) ([]cloudsecrets.SecretSpec, error) {
+	if selector == nil {
+		return secrets, nil
+	}
+
+	lister, ok := p.(provider.SecretLister)
+	if !ok {
+		return nil, errors.New("provider does not support secret discovery")
+	}
+
+	names, err := lister.ListSecrets(ctx, *selector)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Discovered %d secret(s): %v", len(names), names)
+
+	specs := append([]cloudsecrets.SecretSpec{}, secrets...)
+	known := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		known[spec.Name] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			specs = append(specs, cloudsecrets.SecretSpec{Name: name})
+		}
+	}
+
+	return specs, nil
+}
+
+// fetchSecrets fetches the secrets using a bounded pool of workers.
+// The returned secrets keep the order of specs.
+func (c *Controller) fetchSecrets(ctx context.Context, specs []cloudsecrets.SecretSpec) ([]*provider.Secret, error) {
+	concurrency := c.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	secrets := make([]*provider.Secret, len(specs))
+	errs := make([]error, len(specs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, spec := range specs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, spec cloudsecrets.SecretSpec) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			secret, err := provider.GetSecretVersion(ctx, c.Provider, spec.Name, spec.Version)
+			fetchDuration.WithLabelValues(spec.Name).Observe(time.Since(start).Seconds())
+			if err != nil {
+				fetchFailuresTotal.WithLabelValues(spec.Name, provider.ErrorCode(err)).Inc()
+				log.Errorf("Failed to fetch secret %s: %v", spec.Name, err)
+				errs[i] = err
+				return
+			}
+			log.Infof("Fetched secret %s (version: %s)", spec.Name, secret.Version)
+
+			if spec.Alias != "" {
+				secret.Name = spec.Alias
+			}
+			secrets[i] = secret
+		}(i, spec)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	log.Infof("Fetched %d/%d secrets", len(specs)-failed, len(specs))
+	if failed > 0 {
+		return nil, fmt.Errorf("failed to fetch %d secret(s): %w", failed, errors.Join(errs...))
+	}
+
+	return secrets, nil
+}
+
 // MinInterval is used as window for batching events
 const MinInterval = 5 * time.Second
 
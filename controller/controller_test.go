@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kvendingoldo/cloud-secrets/hook"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/sink"
+	"github.com/kvendingoldo/cloud-secrets/sink/dotenv"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingHook counts its runs
+type countingHook struct {
+	runs int
+}
+
+func (h *countingHook) Run(ctx context.Context) error {
+	h.runs++
+	return nil
+}
+
+func (h *countingHook) String() string {
+	return "counting"
+}
+
+func newTestController(t *testing.T, p *fakeProvider, path string, h hook.Hook) *Controller {
+	t.Helper()
+	s, err := dotenv.NewDotenvSink(dotenv.DotenvConfig{Path: path, FileMode: "0600"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadState("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Controller{
+		Provider: p,
+		Sinks:    []sink.Sink{s},
+		Hooks:    []hook.Hook{h},
+		Secrets:  []cloudsecrets.SecretSpec{{Name: "db"}},
+		State:    state,
+	}
+}
+
+func TestRunOnceRestoresDeletedOutput(t *testing.T) {
+	p := newFakeProvider(map[string]string{"db": "hunter2"})
+	path := filepath.Join(t.TempDir(), ".env")
+	h := &countingHook{}
+	c := newTestController(t, p, path, h)
+
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if h.runs != 1 {
+		t.Errorf("hook ran %d times for an unchanged secret, want 1", h.runs)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("deleted output wasn't restored: %v", err)
+	}
+	if string(data) != "DB=\"hunter2\"\n" {
+		t.Errorf("output = %q", data)
+	}
+	if h.runs != 2 {
+		t.Errorf("hook runs = %d, want 2", h.runs)
+	}
+}
+
+func TestRunOnceRestoresModifiedOutput(t *testing.T) {
+	p := newFakeProvider(map[string]string{"db": "hunter2"})
+	path := filepath.Join(t.TempDir(), ".env")
+	c := newTestController(t, p, path, &countingHook{})
+
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("DB=\"modified\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "DB=\"hunter2\"\n" {
+		t.Errorf("modified output wasn't restored: %q", data)
+	}
+}
+
+func TestRunOnceSkipsHooksOnRestart(t *testing.T) {
+	p := newFakeProvider(map[string]string{"db": "hunter2"})
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("DB=\"hunter2\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart without state file starts with an empty state
+	h := &countingHook{}
+	c := newTestController(t, p, path, h)
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if h.runs != 0 {
+		t.Errorf("hook ran %d times although the output is up to date", h.runs)
+	}
+
+	p.secrets["db"] = append(p.secrets["db"], []byte("hunter3"))
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if h.runs != 1 {
+		t.Errorf("hook runs = %d, want 1", h.runs)
+	}
+}
+
+func TestRunOnceLabelsMetricsByProviderName(t *testing.T) {
+	p := newFakeProvider(map[string]string{"prod/db": "hunter2"})
+	c := &Controller{
+		Provider: p,
+		Secrets:  []cloudsecrets.SecretSpec{{Name: "prod/db", Alias: "metrics-db"}},
+	}
+
+	if err := c.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if testutil.ToFloat64(lastSyncTimestamp.WithLabelValues("prod/db")) == 0 {
+		t.Error("no sync timestamp for the provider name")
+	}
+	if lastSyncTimestamp.DeleteLabelValues("metrics-db") {
+		t.Error("sync timestamp labeled by the alias")
+	}
+}
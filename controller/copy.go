@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	log "github.com/sirupsen/logrus"
+)
+
+// Conflict policies of the Copier, applied to secrets which already exist in the destination with a different value
+const (
+	// ConflictSkip leaves existing secrets untouched
+	ConflictSkip = "skip"
+	// ConflictOverwrite adds the value as a new version of existing secrets and replaces their tags with the tags of the source.
+	// Secrets aren't deleted and recreated, as deleted names stay reserved by AWS and Azure until they are purged.
+	ConflictOverwrite = "overwrite"
+	// ConflictNewVersion adds the value as a new version of existing secrets
+	ConflictNewVersion = "new-version"
+)
+
+// copyAction is what the Copier does with a single secret
+type copyAction string
+
+const (
+	actionCreate     copyAction = "create"
+	actionOverwrite  copyAction = "overwrite"
+	actionNewVersion copyAction = "new version"
+	actionUnchanged  copyAction = "unchanged"
+	actionSkip       copyAction = "skip"
+)
+
+// Copier copies secrets from one provider to another, e.g. to migrate between clouds.
+type Copier struct {
+	Source provider.Provider
+	// Destination has to implement provider.SecretWriter
+	Destination provider.Provider
+
+	// The secrets to copy, the alias of a secret is its name in the destination
+	Secrets []cloudsecrets.SecretSpec
+
+	// Selector discovers additional secrets in the source (optional), requires a provider.SecretLister
+	Selector *provider.Selector
+
+	// Conflict is the policy for secrets existing in the destination, one of ConflictSkip, ConflictOverwrite, ConflictNewVersion
+	Conflict string
+
+	// DryRun only reports what would be copied, without writing to the destination
+	DryRun bool
+}
+
+// Run copies all secrets. A failing secret doesn't stop the copy, all failures are returned in the end.
+func (c *Copier) Run(ctx context.Context) error {
+	writer, ok := c.Destination.(provider.SecretWriter)
+	if !ok {
+		return errors.New("destination provider does not support writing secrets")
+	}
+
+	specs, err := secretSpecs(ctx, c.Source, c.Secrets, c.Selector)
+	if err != nil {
+		return err
+	}
+
+	counts := map[copyAction]int{}
+	var errs []error
+	for _, spec := range specs {
+		action, err := c.copySecret(ctx, writer, spec)
+		if err != nil {
+			log.Errorf("Failed to copy secret %s: %v", spec.Name, err)
+			errs = append(errs, err)
+			continue
+		}
+		counts[action]++
+	}
+
+	log.Infof("Copied %d/%d secrets: %d created, %d overwritten, %d new versions, %d unchanged, %d skipped",
+		len(specs)-len(errs), len(specs),
+		counts[actionCreate], counts[actionOverwrite], counts[actionNewVersion], counts[actionUnchanged], counts[actionSkip])
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to copy %d secret(s): %w", len(errs), errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// copySecret copies a single secret including its tags, if the source provides them
+func (c *Copier) copySecret(ctx context.Context, writer provider.SecretWriter, spec cloudsecrets.SecretSpec) (copyAction, error) {
+	secret, err := provider.GetSecretVersion(ctx, c.Source, spec.Name, spec.Version)
+	if err != nil {
+		return "", err
+	}
+
+	var tags map[string]string
+	if getter, ok := c.Source.(provider.TagGetter); ok {
+		tags, err = getter.GetSecretTags(ctx, spec.Name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	name := targetName(spec)
+
+	action, err := c.plan(ctx, name, secret.Value)
+	if err != nil {
+		return "", err
+	}
+
+	if c.DryRun {
+		log.Infof("[dry-run] %s: %s (version: %s) -> %s, tags: %v", action, spec.Name, secret.Version, name, tags)
+		return action, nil
+	}
+
+	var version string
+	switch action {
+	case actionCreate:
+		version, err = writer.CreateSecret(ctx, name, secret.Value, tags)
+	case actionOverwrite:
+		version, err = c.overwrite(ctx, writer, name, secret.Value, tags)
+	case actionNewVersion:
+		version, err = writer.UpdateSecret(ctx, name, secret.Value)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("%s: %s (version: %s) -> %s (version: %s)", action, spec.Name, secret.Version, name, version)
+	return action, nil
+}
+
+// overwrite adds value as a new version of an existing secret and replaces its tags
+func (c *Copier) overwrite(ctx context.Context, writer provider.SecretWriter, name string, value []byte, tags map[string]string) (string, error) {
+	version, err := writer.UpdateSecret(ctx, name, value)
+	if err != nil {
+		return "", err
+	}
+
+	// Without tags of the source the tags of the destination are kept
+	if _, ok := c.Source.(provider.TagGetter); !ok {
+		return version, nil
+	}
+	setter, ok := c.Destination.(provider.TagSetter)
+	if !ok {
+		log.Warnf("Destination provider does not support replacing tags, kept the tags of secret %s", name)
+		return version, nil
+	}
+	if err := setter.SetSecretTags(ctx, name, tags); err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+// plan returns the action for a secret depending on whether it exists in the destination.
+// Secrets which already have the value are never written, so repeated copies don't pile up versions.
+func (c *Copier) plan(ctx context.Context, name string, value []byte) (copyAction, error) {
+	existing, err := c.Destination.GetSecret(ctx, name)
+	if provider.IsNotFound(err) {
+		return actionCreate, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Equal(existing.Value, value) {
+		return actionUnchanged, nil
+	}
+
+	switch c.Conflict {
+	case ConflictOverwrite:
+		return actionOverwrite, nil
+	case ConflictNewVersion:
+		return actionNewVersion, nil
+	default:
+		return actionSkip, nil
+	}
+}
+
+// targetName returns the name of the secret of spec in the target
+func targetName(spec cloudsecrets.SecretSpec) string {
+	if spec.Alias != "" {
+		return spec.Alias
+	}
+	return spec.Name
+}
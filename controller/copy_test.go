@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+)
+
+func TestCopierConflicts(t *testing.T) {
+	tests := []struct {
+		conflict     string
+		wantVersions int
+		wantValue    string
+		wantTags     map[string]string
+	}{
+		{conflict: ConflictSkip, wantVersions: 1, wantValue: "old", wantTags: map[string]string{"team": "old", "stale": "true"}},
+		{conflict: ConflictNewVersion, wantVersions: 2, wantValue: "new", wantTags: map[string]string{"team": "old", "stale": "true"}},
+		{conflict: ConflictOverwrite, wantVersions: 2, wantValue: "new", wantTags: map[string]string{"team": "new"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.conflict, func(t *testing.T) {
+			source := newFakeProvider(map[string]string{"db": "new"})
+			source.tags["db"] = map[string]string{"team": "new"}
+			destination := newFakeProvider(map[string]string{"db": "old"})
+			destination.tags["db"] = map[string]string{"team": "old", "stale": "true"}
+
+			c := &Copier{
+				Source:      source,
+				Destination: destination,
+				Secrets:     []cloudsecrets.SecretSpec{{Name: "db"}},
+				Conflict:    tt.conflict,
+			}
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			versions := destination.secrets["db"]
+			if len(versions) != tt.wantVersions {
+				t.Errorf("versions = %d, want %d", len(versions), tt.wantVersions)
+			}
+			if got := string(versions[len(versions)-1]); got != tt.wantValue {
+				t.Errorf("value = %q, want %q", got, tt.wantValue)
+			}
+			if got := destination.tags["db"]; !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("tags = %v, want %v", got, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestCopierCreatesAndSkipsUnchanged(t *testing.T) {
+	source := newFakeProvider(map[string]string{"db": "value", "api-key": "key"})
+	source.tags["db"] = map[string]string{"team": "a"}
+	destination := newFakeProvider(map[string]string{"api-key": "key"})
+
+	c := &Copier{
+		Source:      source,
+		Destination: destination,
+		Secrets:     []cloudsecrets.SecretSpec{{Name: "db", Alias: "prod-db"}, {Name: "api-key"}},
+		Conflict:    ConflictOverwrite,
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(destination.secrets["prod-db"][0]); got != "value" {
+		t.Errorf("value = %q", got)
+	}
+	if got := destination.tags["prod-db"]; !reflect.DeepEqual(got, map[string]string{"team": "a"}) {
+		t.Errorf("tags = %v", got)
+	}
+	if n := len(destination.secrets["api-key"]); n != 1 {
+		t.Errorf("unchanged secret has %d versions", n)
+	}
+}
+
+func TestCopierDryRun(t *testing.T) {
+	source := newFakeProvider(map[string]string{"db": "new"})
+	destination := newFakeProvider(map[string]string{"db": "old"})
+
+	c := &Copier{
+		Source:      source,
+		Destination: destination,
+		Secrets:     []cloudsecrets.SecretSpec{{Name: "db"}},
+		Conflict:    ConflictOverwrite,
+		DryRun:      true,
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(destination.secrets["db"]); n != 1 {
+		t.Errorf("dry run wrote %d versions", n)
+	}
+}
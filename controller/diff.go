@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+// Differ compares secrets of two providers, e.g. of the staging and the production account.
+// Secrets holding a JSON object are compared key by key, other secrets by their whole value.
+type Differ struct {
+	Source provider.Provider
+	Target provider.Provider
+
+	// The secrets to compare, the alias of a secret is its name in the target
+	Secrets []cloudsecrets.SecretSpec
+
+	// Selector discovers additional secrets in both providers (optional), requires a provider.SecretLister
+	Selector *provider.Selector
+
+	// ShowValues prints the differing values instead of their hashes
+	ShowValues bool
+
+	// key of the value hashes, random per run so hashes of low-entropy values can't be brute-forced
+	key []byte
+}
+
+// Run writes the differences to w, one per line. Lines start with "-" for secrets or keys only in the source,
+// "+" for secrets or keys only in the target and "~" for different values. It returns whether any secret differs.
+func (d *Differ) Run(ctx context.Context, w io.Writer) (bool, error) {
+	d.key = make([]byte, sha256.Size)
+	if _, err := rand.Read(d.key); err != nil {
+		return false, fmt.Errorf("failed to generate hash key: %w", err)
+	}
+
+	specs, err := secretSpecs(ctx, d.Source, d.Secrets, d.Selector)
+	if err != nil {
+		return false, err
+	}
+	if d.Selector != nil {
+		// Secrets which only exist in the target are differences as well
+		targetSpecs, err := secretSpecs(ctx, d.Target, nil, d.Selector)
+		if err != nil {
+			return false, err
+		}
+		known := make(map[string]bool, len(specs))
+		for _, spec := range specs {
+			known[targetName(spec)] = true
+		}
+		for _, spec := range targetSpecs {
+			if !known[spec.Name] {
+				specs = append(specs, spec)
+			}
+		}
+	}
+
+	differ := 0
+	for _, spec := range specs {
+		source, err := d.getSecret(ctx, d.Source, spec)
+		if err != nil {
+			return false, err
+		}
+		target, err := d.getSecret(ctx, d.Target, cloudsecrets.SecretSpec{Name: targetName(spec), Version: spec.Version})
+		if err != nil {
+			return false, err
+		}
+
+		lines := d.diffSecret(spec.Name, source, target)
+		if len(lines) > 0 {
+			differ++
+		}
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "%d/%d secrets differ\n", differ, len(specs)); err != nil {
+		return false, err
+	}
+
+	return differ > 0, nil
+}
+
+// getSecret fetches a secret, returning nil if it doesn't exist
+func (d *Differ) getSecret(ctx context.Context, p provider.Provider, spec cloudsecrets.SecretSpec) (*provider.Secret, error) {
+	secret, err := provider.GetSecretVersion(ctx, p, spec.Name, spec.Version)
+	if provider.IsNotFound(err) {
+		return nil, nil
+	}
+	return secret, err
+}
+
+// diffSecret returns the differences of a secret, source or target are nil if the secret doesn't exist
+func (d *Differ) diffSecret(name string, source, target *provider.Secret) []string {
+	switch {
+	case source == nil && target == nil:
+		return nil
+	case target == nil:
+		return []string{fmt.Sprintf("- %s: %s", name, d.format(source.Value))}
+	case source == nil:
+		return []string{fmt.Sprintf("+ %s: %s", name, d.format(target.Value))}
+	}
+
+	sourceKeys, sourceOk := source.KeyValues()
+	targetKeys, targetOk := target.KeyValues()
+	if !sourceOk || !targetOk {
+		if string(source.Value) == string(target.Value) {
+			return nil
+		}
+		return []string{fmt.Sprintf("~ %s: %s -> %s", name, d.format(source.Value), d.format(target.Value))}
+	}
+
+	keys := make([]string, 0, len(sourceKeys)+len(targetKeys))
+	for k := range sourceKeys {
+		keys = append(keys, k)
+	}
+	for k := range targetKeys {
+		if _, ok := sourceKeys[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, k := range keys {
+		sourceValue, inSource := sourceKeys[k]
+		targetValue, inTarget := targetKeys[k]
+		switch {
+		case !inTarget:
+			lines = append(lines, fmt.Sprintf("- %s.%s: %s", name, k, d.format([]byte(sourceValue))))
+		case !inSource:
+			lines = append(lines, fmt.Sprintf("+ %s.%s: %s", name, k, d.format([]byte(targetValue))))
+		case sourceValue != targetValue:
+			lines = append(lines, fmt.Sprintf("~ %s.%s: %s -> %s", name, k, d.format([]byte(sourceValue)), d.format([]byte(targetValue))))
+		}
+	}
+
+	return lines
+}
+
+// format returns the value to print unless values are shown, a shortened HMAC-SHA256 keyed per run.
+// Equal values have equal hashes within a run, but hashes can't be compared across runs.
+func (d *Differ) format(value []byte) string {
+	if d.ShowValues {
+		return fmt.Sprintf("%q", value)
+	}
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write(value)
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
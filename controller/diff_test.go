@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+)
+
+func TestDifferShowValues(t *testing.T) {
+	source := newFakeProvider(map[string]string{
+		"db":     `{"user":"app","password":"old","host":"a"}`,
+		"token":  "same",
+		"source": "only",
+	})
+	target := newFakeProvider(map[string]string{
+		"db":    `{"user":"app","password":"new","port":"5432"}`,
+		"token": "same",
+	})
+
+	d := &Differ{
+		Source:     source,
+		Target:     target,
+		Secrets:    []cloudsecrets.SecretSpec{{Name: "db"}, {Name: "token"}, {Name: "source"}},
+		ShowValues: true,
+	}
+	var out bytes.Buffer
+	differ, err := d.Run(context.Background(), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !differ {
+		t.Error("expected differences")
+	}
+
+	want := strings.Join([]string{
+		`- db.host: "a"`,
+		`~ db.password: "old" -> "new"`,
+		`+ db.port: "5432"`,
+		`- source: "only"`,
+		`2/3 secrets differ`,
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+var hashPattern = regexp.MustCompile(`hmac:[0-9a-f]{12}`)
+
+func TestDifferHashesAreKeyedPerRun(t *testing.T) {
+	source := newFakeProvider(map[string]string{"a": "1234", "b": "1234"})
+	target := newFakeProvider(nil)
+
+	d := &Differ{
+		Source:  source,
+		Target:  target,
+		Secrets: []cloudsecrets.SecretSpec{{Name: "a"}, {Name: "b"}},
+	}
+
+	run := func() []string {
+		var out bytes.Buffer
+		if _, err := d.Run(context.Background(), &out); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out.String(), "1234") {
+			t.Errorf("output contains the value: %s", out.String())
+		}
+		return hashPattern.FindAllString(out.String(), -1)
+	}
+
+	first := run()
+	if len(first) != 2 {
+		t.Fatalf("hashes = %v", first)
+	}
+	if first[0] != first[1] {
+		t.Errorf("equal values have different hashes within a run: %v", first)
+	}
+	if second := run(); second[0] == first[0] {
+		t.Errorf("hashes are equal across runs: %s", first[0])
+	}
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	syncAttemptsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "controller",
+			Name:      "sync_attempts_total",
+			Help:      "Number of synchronization attempts.",
+		},
+	)
+	syncFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "controller",
+			Name:      "sync_failures_total",
+			Help:      "Number of failed synchronizations.",
+		},
+	)
+	fetchFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "provider",
+			Name:      "fetch_failures_total",
+			Help:      "Number of failed secret fetches by secret and provider error code.",
+		},
+		[]string{"secret", "code"},
+	)
+	fetchDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "provider",
+			Name:      "fetch_duration_seconds",
+			Help:      "Latency of secret fetches.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"secret"},
+	)
+	lastSyncTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "controller",
+			Name:      "last_sync_timestamp_seconds",
+			Help:      "Timestamp of the last successful synchronization of a secret.",
+		},
+		[]string{"secret"},
+	)
+	secretAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "controller",
+			Name:      "secret_age_seconds",
+			Help:      "Age of the synchronized version of a secret, if reported by the provider.",
+		},
+		[]string{"secret"},
+	)
+
+	// The operator metrics are labeled by the namespace and name of the CloudSecret
+	// in addition to the secret, their series are removed when the CloudSecret is deleted.
+	operatorFetchFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "operator",
+			Name:      "fetch_failures_total",
+			Help:      "Number of failed secret fetches by CloudSecret, secret and provider error code.",
+		},
+		[]string{"namespace", "cloudsecret", "secret", "code"},
+	)
+	operatorFetchDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "operator",
+			Name:      "fetch_duration_seconds",
+			Help:      "Latency of secret fetches by CloudSecret.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"namespace", "cloudsecret", "secret"},
+	)
+	operatorLastSyncTimestamp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "operator",
+			Name:      "last_sync_timestamp_seconds",
+			Help:      "Timestamp of the last successful synchronization of a secret by CloudSecret.",
+		},
+		[]string{"namespace", "cloudsecret", "secret"},
+	)
+	operatorSecretAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "cloud_secrets",
+			Subsystem: "operator",
+			Name:      "secret_age_seconds",
+			Help:      "Age of the synchronized version of a secret by CloudSecret, if reported by the provider.",
+		},
+		[]string{"namespace", "cloudsecret", "secret"},
+	)
+)
+
+// deleteOperatorMetrics removes the series of a deleted CloudSecret
+func deleteOperatorMetrics(namespace string, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "cloudsecret": name}
+	operatorFetchFailuresTotal.DeletePartialMatch(labels)
+	operatorFetchDuration.DeletePartialMatch(labels)
+	operatorLastSyncTimestamp.DeletePartialMatch(labels)
+	operatorSecretAge.DeletePartialMatch(labels)
+}
+
+func init() {
+	prometheus.MustRegister(syncAttemptsTotal)
+	prometheus.MustRegister(syncFailuresTotal)
+	prometheus.MustRegister(fetchFailuresTotal)
+	prometheus.MustRegister(fetchDuration)
+	prometheus.MustRegister(lastSyncTimestamp)
+	prometheus.MustRegister(secretAge)
+	prometheus.MustRegister(operatorFetchFailuresTotal)
+	prometheus.MustRegister(operatorFetchDuration)
+	prometheus.MustRegister(operatorLastSyncTimestamp)
+	prometheus.MustRegister(operatorSecretAge)
+}
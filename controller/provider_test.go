@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+// fakeProvider is an in-memory provider with versioned, tagged secrets
+type fakeProvider struct {
+	secrets map[string][][]byte
+	tags    map[string]map[string]string
+	// err is returned by GetSecret if set
+	err error
+}
+
+func newFakeProvider(secrets map[string]string) *fakeProvider {
+	p := &fakeProvider{secrets: map[string][][]byte{}, tags: map[string]map[string]string{}}
+	for name, value := range secrets {
+		p.secrets[name] = [][]byte{[]byte(value)}
+	}
+	return p
+}
+
+func (p *fakeProvider) GetSecret(ctx context.Context, name string) (*provider.Secret, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	versions, ok := p.secrets[name]
+	if !ok {
+		return nil, &provider.Error{Code: "404", Err: fmt.Errorf("secret %s not found", name)}
+	}
+	return &provider.Secret{Name: name, Value: versions[len(versions)-1], Version: strconv.Itoa(len(versions))}, nil
+}
+
+func (p *fakeProvider) GetSecretTags(ctx context.Context, name string) (map[string]string, error) {
+	return p.tags[name], nil
+}
+
+func (p *fakeProvider) SetSecretTags(ctx context.Context, name string, tags map[string]string) error {
+	p.tags[name] = tags
+	return nil
+}
+
+func (p *fakeProvider) CreateSecret(ctx context.Context, name string, value []byte, tags map[string]string) (string, error) {
+	if _, ok := p.secrets[name]; ok {
+		return "", provider.ErrSecretExists
+	}
+	p.secrets[name] = [][]byte{value}
+	p.tags[name] = tags
+	return "1", nil
+}
+
+func (p *fakeProvider) UpdateSecret(ctx context.Context, name string, value []byte) (string, error) {
+	if _, ok := p.secrets[name]; !ok {
+		return "", &provider.Error{Code: "404", Err: fmt.Errorf("secret %s not found", name)}
+	}
+	p.secrets[name] = append(p.secrets[name], value)
+	return strconv.Itoa(len(p.secrets[name])), nil
+}
+
+// DeleteSecret keeps the name reserved like the soft-delete of AWS and Azure
+func (p *fakeProvider) DeleteSecret(ctx context.Context, name string) error {
+	return fmt.Errorf("secret %s is scheduled for deletion", name)
+}
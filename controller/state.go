@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/sink"
+)
+
+// State remembers the last synchronized version of each secret,
+// so sinks are only written when a secret actually changed.
+type State struct {
+	// The path the state is persisted to, empty keeps the state in memory only
+	path string
+
+	versions    map[string]string
+	versionsMux sync.Mutex
+}
+
+// stateFile is the on-disk representation of State
+type stateFile struct {
+	Versions map[string]string `json:"versions"`
+}
+
+// LoadState returns the state persisted at path.
+// A missing file results in an empty state, an empty path in an in-memory state.
+func LoadState(path string) (*State, error) {
+	s := &State{
+		path:     path,
+		versions: map[string]string{},
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	for k, v := range file.Versions {
+		s.versions[k] = v
+	}
+
+	return s, nil
+}
+
+// Changed returns the names of the secrets whose version differs from the recorded one.
+// Secrets which are recorded but no longer present are reported as changed as well.
+func (s *State) Changed(secrets []*provider.Secret) []string {
+	s.versionsMux.Lock()
+	defer s.versionsMux.Unlock()
+
+	var changed []string
+	seen := make(map[string]bool, len(secrets))
+	for _, secret := range secrets {
+		seen[secret.Name] = true
+		if s.versions[secret.Name] != version(secret) {
+			changed = append(changed, secret.Name)
+		}
+	}
+	for name := range s.versions {
+		if !seen[name] {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
+
+// Update records the versions of secrets, replacing all previously recorded versions,
+// and persists the state if it has a path.
+func (s *State) Update(secrets []*provider.Secret) error {
+	s.versionsMux.Lock()
+	defer s.versionsMux.Unlock()
+
+	s.versions = make(map[string]string, len(secrets))
+	for _, secret := range secrets {
+		s.versions[secret.Name] = version(secret)
+	}
+
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(stateFile{Versions: s.versions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := sink.WriteFile(s.path, data, 0600, -1, -1); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return nil
+}
+
+// version returns the provider version of secret, or a hash of its value
+// if the provider does not report versions.
+func version(secret *provider.Secret) string {
+	if secret.Version != "" {
+		return secret.Version
+	}
+	sum := sha256.Sum256(secret.Value)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,167 @@
+// Package csi implements the provider gRPC service of the Secrets Store CSI Driver.
+package csi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/v1alpha1"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/store"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+	csiv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const (
+	// ProviderName is the provider of SecretProviderClasses served by cloud-secrets
+	ProviderName = "cloud-secrets"
+
+	// Parameters of SecretProviderClasses
+	ParameterObjects   = "objects"
+	ParameterStoreKind = "storeKind"
+	ParameterStoreName = "storeName"
+
+	// Attributes of the mounting pod, set by the driver
+	attributePodName      = "csi.storage.k8s.io/pod.name"
+	attributePodNamespace = "csi.storage.k8s.io/pod.namespace"
+)
+
+// Server mounts secrets of SecretProviderClasses as files, e.g.
+//
+//	spec:
+//	  provider: cloud-secrets
+//	  parameters:
+//	    storeName: prod        # a SecretStore of the pod namespace
+//	    storeKind: SecretStore # optional, SecretStore (default) or ClusterSecretStore
+//	    objects: |
+//	      - name: prod/db
+//	        alias: db          # the file name, defaults to the secret name
+//	      - name: prod/api-key
+//	        version: "3"
+//
+// Every secret is written to a single file, JSON objects aren't split into keys.
+// The object versions are the provider versions of the secrets, or hashes of their values for providers
+// without versions, so the rotation reconciler of the driver picks up changes.
+//
+// Every SecretProviderClass has to reference a store: the plugin runs on every node with access to
+// the stores, so secrets are only mounted with the credentials a store grants to the namespace of the pod.
+type Server struct {
+	csiv1alpha1.UnimplementedCSIDriverProviderServer
+
+	// Stores instantiates the providers of referenced SecretStores and ClusterSecretStores
+	Stores *store.Manager
+}
+
+func (s *Server) Version(ctx context.Context, req *csiv1alpha1.VersionRequest) (*csiv1alpha1.VersionResponse, error) {
+	return &csiv1alpha1.VersionResponse{
+		Version:        "v1alpha1",
+		RuntimeName:    ProviderName,
+		RuntimeVersion: cloudsecrets.Version,
+	}, nil
+}
+
+func (s *Server) Mount(ctx context.Context, req *csiv1alpha1.MountRequest) (*csiv1alpha1.MountResponse, error) {
+	var attributes map[string]string
+	if err := json.Unmarshal([]byte(req.GetAttributes()), &attributes); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse attributes: %v", err)
+	}
+	var mode os.FileMode
+	if err := json.Unmarshal([]byte(req.GetPermission()), &mode); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse permission: %v", err)
+	}
+
+	var specs []cloudsecrets.SecretSpec
+	if err := yaml.Unmarshal([]byte(attributes[ParameterObjects]), &specs); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse parameter %s: %v", ParameterObjects, err)
+	}
+	if len(specs) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "parameter %s lists no secrets", ParameterObjects)
+	}
+
+	p, err := s.provider(ctx, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, len(specs))
+	secretsByPath := map[string]string{}
+	for i, spec := range specs {
+		path := spec.Alias
+		if path == "" {
+			path = spec.Name
+		}
+		if !filepath.IsLocal(filepath.FromSlash(path)) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid file name of secret %s: %s", spec.Name, path)
+		}
+		// Paths are compared cleaned, a/b and a//b are the same file
+		clean := filepath.Clean(filepath.FromSlash(path))
+		if other, ok := secretsByPath[clean]; ok {
+			return nil, status.Errorf(codes.InvalidArgument, "secrets %s and %s are written to the same file %s", other, spec.Name, path)
+		}
+		secretsByPath[clean] = spec.Name
+		paths[i] = path
+	}
+
+	resp := &csiv1alpha1.MountResponse{}
+	for i, spec := range specs {
+		path := paths[i]
+		secret, err := provider.GetSecretVersion(ctx, p, spec.Name, spec.Version)
+		if err != nil {
+			switch {
+			case provider.IsNotFound(err):
+				return nil, status.Error(codes.NotFound, err.Error())
+			case provider.IsPermissionDenied(err):
+				return nil, status.Error(codes.PermissionDenied, err.Error())
+			}
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		resp.ObjectVersion = append(resp.ObjectVersion, &csiv1alpha1.ObjectVersion{
+			Id:      path,
+			Version: objectVersion(secret),
+		})
+		resp.Files = append(resp.Files, &csiv1alpha1.File{
+			Path:     path,
+			Mode:     int32(mode),
+			Contents: secret.Value,
+		})
+	}
+	log.Infof("Mounted %d secret(s) for pod %s/%s", len(resp.Files), attributes[attributePodNamespace], attributes[attributePodName])
+
+	return resp, nil
+}
+
+// provider returns the provider of the store referenced by the parameters
+func (s *Server) provider(ctx context.Context, attributes map[string]string) (provider.Provider, error) {
+	name := attributes[ParameterStoreName]
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "parameter %s is required", ParameterStoreName)
+	}
+
+	kind := attributes[ParameterStoreKind]
+	if kind == "" {
+		kind = v1alpha1.SecretStoreKind
+	}
+	p, err := s.Stores.Provider(ctx, attributes[attributePodNamespace], v1alpha1.ProviderRef{Kind: kind, Name: name})
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return p, nil
+}
+
+// objectVersion returns the version of secret, a hash of the value if the provider has no versions
+func objectVersion(secret *provider.Secret) string {
+	if secret.Version != "" {
+		return secret.Version
+	}
+	sum := sha256.Sum256(secret.Value)
+	return hex.EncodeToString(sum[:])[:12]
+}
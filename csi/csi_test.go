@@ -0,0 +1,222 @@
+package csi
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/kvendingoldo/cloud-secrets/internal/fixtures"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/v1alpha1"
+	"github.com/kvendingoldo/cloud-secrets/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	csiv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+func newTestServer(t *testing.T) (*Server, *fixtures.Vault) {
+	t.Helper()
+	vault := fixtures.NewVault(t, "s.token")
+
+	vaultStore := func(mountPath string, kvVersion int) v1alpha1.SecretStoreSpec {
+		return v1alpha1.SecretStoreSpec{Provider: v1alpha1.StoreProvider{Vault: &v1alpha1.VaultStoreProvider{
+			Server:    vault.URL,
+			MountPath: mountPath,
+			KVVersion: kvVersion,
+			Auth:      v1alpha1.VaultAuth{TokenSecretRef: &v1alpha1.SecretKeySelector{Name: "vault", Key: "token"}},
+		}}}
+	}
+	c := fixtures.NewClientBuilder(t).WithObjects(
+		&v1alpha1.SecretStore{ObjectMeta: metav1.ObjectMeta{Name: "kv2", Namespace: "apps"}, Spec: vaultStore("kv2", 2)},
+		&v1alpha1.SecretStore{ObjectMeta: metav1.ObjectMeta{Name: "kv1", Namespace: "apps"}, Spec: vaultStore("kv1", 1)},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault", Namespace: "apps"},
+			Data:       map[string][]byte{"token": []byte("s.token")},
+		},
+	).Build()
+
+	return &Server{Stores: store.NewManager(c, &cloudsecrets.Config{})}, vault
+}
+
+func mountRequest(t *testing.T, namespace string, parameters map[string]string) *csiv1alpha1.MountRequest {
+	t.Helper()
+	attributes := map[string]string{
+		attributePodName:      "app",
+		attributePodNamespace: namespace,
+	}
+	for k, v := range parameters {
+		attributes[k] = v
+	}
+	raw, err := json.Marshal(attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &csiv1alpha1.MountRequest{
+		Attributes: string(raw),
+		Permission: strconv.Itoa(0o640),
+		TargetPath: "/var/lib/kubelet/pods/uid/volumes/kubernetes.io~csi/secrets/mount",
+	}
+}
+
+// versions returns the object versions of resp by id
+func versions(resp *csiv1alpha1.MountResponse) map[string]string {
+	versions := map[string]string{}
+	for _, v := range resp.ObjectVersion {
+		versions[v.Id] = v.Version
+	}
+	return versions
+}
+
+func TestMount(t *testing.T) {
+	s, f := newTestServer(t)
+	f.Set("kv2/prod/db", map[string]string{"value": "hunter2"})
+	f.Set("kv2/prod/api-key", map[string]string{"value": "key"})
+
+	resp, err := s.Mount(context.Background(), mountRequest(t, "apps", map[string]string{
+		ParameterStoreName: "kv2",
+		ParameterObjects:   "- name: prod/db\n  alias: db\n- name: prod/api-key\n",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Files) != 2 {
+		t.Fatalf("files = %v", resp.Files)
+	}
+	if f := resp.Files[0]; f.Path != "db" || string(f.Contents) != `{"value":"hunter2"}` || f.Mode != 0o640 {
+		t.Errorf("file = %+v", f)
+	}
+	if f := resp.Files[1]; f.Path != "prod/api-key" {
+		t.Errorf("file = %+v", f)
+	}
+	if got := versions(resp); got["db"] != "1" || got["prod/api-key"] != "1" {
+		t.Errorf("versions = %v", got)
+	}
+}
+
+// The rotation reconciler of the driver compares the object versions of two mounts
+// and rewrites the files if a version changed
+func TestMountRotation(t *testing.T) {
+	tests := []struct {
+		store string
+		// versioned stores report the provider version, others a hash of the value
+		versioned bool
+	}{
+		{store: "kv2", versioned: true},
+		{store: "kv1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.store, func(t *testing.T) {
+			s, f := newTestServer(t)
+			f.Set(tt.store+"/db", map[string]string{"value": "old"})
+			req := mountRequest(t, "apps", map[string]string{ParameterStoreName: tt.store, ParameterObjects: "- name: db\n"})
+
+			first, err := s.Mount(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unchanged, err := s.Mount(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if versions(first)["db"] != versions(unchanged)["db"] {
+				t.Errorf("version changed without a change of the secret: %v -> %v", versions(first), versions(unchanged))
+			}
+
+			f.Set(tt.store+"/db", map[string]string{"value": "new"})
+			rotated, err := s.Mount(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if versions(first)["db"] == versions(rotated)["db"] {
+				t.Errorf("version didn't change after the rotation: %v", versions(rotated))
+			}
+			if tt.versioned && versions(rotated)["db"] != "2" {
+				t.Errorf("version = %v, want the provider version 2", versions(rotated))
+			}
+			if got := string(rotated.Files[0].Contents); got != `{"value":"new"}` {
+				t.Errorf("contents = %s", got)
+			}
+		})
+	}
+}
+
+func TestMountErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespace  string
+		parameters map[string]string
+		code       codes.Code
+	}{
+		{
+			name:       "no store",
+			namespace:  "apps",
+			parameters: map[string]string{ParameterObjects: "- name: db\n"},
+			code:       codes.InvalidArgument,
+		},
+		{
+			name:       "store of another namespace",
+			namespace:  "other",
+			parameters: map[string]string{ParameterStoreName: "kv2", ParameterObjects: "- name: db\n"},
+			code:       codes.FailedPrecondition,
+		},
+		{
+			name:       "unknown store kind",
+			namespace:  "apps",
+			parameters: map[string]string{ParameterStoreName: "kv2", ParameterStoreKind: "Store", ParameterObjects: "- name: db\n"},
+			code:       codes.FailedPrecondition,
+		},
+		{
+			name:       "no objects",
+			namespace:  "apps",
+			parameters: map[string]string{ParameterStoreName: "kv2"},
+			code:       codes.InvalidArgument,
+		},
+		{
+			name:       "invalid file name",
+			namespace:  "apps",
+			parameters: map[string]string{ParameterStoreName: "kv2", ParameterObjects: "- name: db\n  alias: ../db\n"},
+			code:       codes.InvalidArgument,
+		},
+		{
+			name:       "duplicate file name",
+			namespace:  "apps",
+			parameters: map[string]string{ParameterStoreName: "kv2", ParameterObjects: "- name: db\n- name: prod/db\n  alias: db\n"},
+			code:       codes.InvalidArgument,
+		},
+		{
+			name:       "duplicate unclean file name",
+			namespace:  "apps",
+			parameters: map[string]string{ParameterStoreName: "kv2", ParameterObjects: "- name: prod/db\n- name: db\n  alias: prod//db\n"},
+			code:       codes.InvalidArgument,
+		},
+		{
+			name:       "permission denied",
+			namespace:  "apps",
+			parameters: map[string]string{ParameterStoreName: "kv2", ParameterObjects: "- name: secret\n"},
+			code:       codes.PermissionDenied,
+		},
+		{
+			name:       "missing secret",
+			namespace:  "apps",
+			parameters: map[string]string{ParameterStoreName: "kv2", ParameterObjects: "- name: missing\n"},
+			code:       codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, f := newTestServer(t)
+			f.Set("kv2/db", map[string]string{"value": "value"})
+			f.Set("kv2/secret", map[string]string{"value": "value"})
+			f.Deny("kv2/secret")
+
+			_, err := s.Mount(context.Background(), mountRequest(t, tt.namespace, tt.parameters))
+			if status.Code(err) != tt.code {
+				t.Errorf("error = %v, want code %v", err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CommandHook runs a shell command.
+type CommandHook struct {
+	command string
+}
+
+func NewCommandHook(command string) *CommandHook {
+	return &CommandHook{
+		command: command,
+	}
+}
+
+func (h *CommandHook) Run(ctx context.Context) error {
+	output, err := exec.CommandContext(ctx, "sh", "-c", h.command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	log.Debugf("Hook %s output: %s", h, output)
+
+	return nil
+}
+
+func (h *CommandHook) String() string {
+	return fmt.Sprintf("command(%s)", h.command)
+}
@@ -0,0 +1,66 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Hook is an action run after secrets changed, e.g. to make an application reload them.
+type Hook interface {
+	Run(ctx context.Context) error
+	String() string
+}
+
+// retryingHook runs a hook with a timeout per attempt and retries on failure
+type retryingHook struct {
+	hook    Hook
+	timeout time.Duration
+	retries int
+}
+
+// WithRetry wraps h so that each attempt is limited by timeout and failed attempts are retried up to retries times.
+func WithRetry(h Hook, timeout time.Duration, retries int) Hook {
+	return &retryingHook{
+		hook:    h,
+		timeout: timeout,
+		retries: retries,
+	}
+}
+
+func (h *retryingHook) Run(ctx context.Context) error {
+	var err error
+	for attempt := 0; attempt <= h.retries; attempt++ {
+		if attempt > 0 {
+			// Linear backoff between attempts
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			log.Warnf("Retrying hook %s (attempt %d/%d): %v", h.hook, attempt, h.retries, err)
+		}
+
+		err = h.runOnce(ctx)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("hook %s failed: %w", h.hook, err)
+}
+
+func (h *retryingHook) runOnce(ctx context.Context) error {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	return h.hook.Run(ctx)
+}
+
+func (h *retryingHook) String() string {
+	return h.hook.String()
+}
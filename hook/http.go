@@ -0,0 +1,48 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPHook sends a request to an HTTP endpoint, e.g. a local reload endpoint.
+// Any non-2xx response is considered a failure.
+type HTTPHook struct {
+	url    string
+	method string
+	client *http.Client
+}
+
+func NewHTTPHook(url string, method string) *HTTPHook {
+	return &HTTPHook{
+		url:    url,
+		method: method,
+		client: http.DefaultClient,
+	}
+}
+
+func (h *HTTPHook) Run(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, h.method, h.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (h *HTTPHook) String() string {
+	return fmt.Sprintf("http(%s %s)", h.method, h.url)
+}
@@ -0,0 +1,65 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// ParseSignal parses a signal name such as "SIGHUP" or "HUP".
+func ParseSignal(name string) (syscall.Signal, error) {
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported signal: %s", name)
+	}
+	return sig, nil
+}
+
+// SignalHook sends a signal to the process whose PID is stored in a pidfile.
+// The pidfile is read on every run, so restarts of the process are picked up.
+type SignalHook struct {
+	pidFile string
+	signal  syscall.Signal
+}
+
+func NewSignalHook(pidFile string, signal string) (*SignalHook, error) {
+	sig, err := ParseSignal(signal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignalHook{
+		pidFile: pidFile,
+		signal:  sig,
+	}, nil
+}
+
+func (h *SignalHook) Run(ctx context.Context) error {
+	data, err := os.ReadFile(h.pidFile)
+	if err != nil {
+		return fmt.Errorf("failed to read pidfile: %w", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return fmt.Errorf("invalid pid in %s: %q", h.pidFile, strings.TrimSpace(string(data)))
+	}
+
+	return syscall.Kill(pid, h.signal)
+}
+
+func (h *SignalHook) String() string {
+	return fmt.Sprintf("signal(%s -> %s)", h.signal, h.pidFile)
+}
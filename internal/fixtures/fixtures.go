@@ -0,0 +1,110 @@
+// Package fixtures provides the fixtures shared by the tests of the Kubernetes integrations.
+package fixtures
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// NewClientBuilder returns a builder of fake clients knowing the Kubernetes and the cloud-secrets types
+func NewClientBuilder(t *testing.T) *fake.ClientBuilder {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme)
+}
+
+// Vault is a fake Vault server serving KV secrets, whose values can be replaced while it runs.
+// Reads of <mount>/data/<name> are answered as KV v2, all other reads as KV v1.
+type Vault struct {
+	// URL of the server, closed when the test finishes
+	URL string
+
+	token string
+
+	mu sync.Mutex
+	// data by path of the secret including the mount, e.g. secret/db
+	data map[string]map[string]string
+	// versions of the secrets, incremented on every change
+	versions map[string]int
+	// paths of the secrets the token is denied access to
+	denied map[string]bool
+}
+
+// NewVault starts a Vault server accepting token
+func NewVault(t *testing.T, token string) *Vault {
+	t.Helper()
+	v := &Vault{
+		token:    token,
+		data:     map[string]map[string]string{},
+		versions: map[string]int{},
+		denied:   map[string]bool{},
+	}
+	server := httptest.NewServer(v)
+	t.Cleanup(server.Close)
+	v.URL = server.URL
+	return v
+}
+
+// Set replaces the data of the secret at path and increments its version
+func (v *Vault) Set(path string, data map[string]string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.data[path] = data
+	v.versions[path]++
+}
+
+// Deny denies the token access to the secret at path
+func (v *Vault) Deny(path string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.denied[path] = true
+}
+
+func (v *Vault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	kv2 := false
+	if mount, name, ok := strings.Cut(path, "/data/"); ok && !strings.Contains(mount, "/") {
+		path, kv2 = mount+"/"+name, true
+	}
+	if r.Header.Get("X-Vault-Token") != v.token || v.denied[path] {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+	data, ok := v.data[path]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+		return
+	}
+	if kv2 {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"data":     data,
+			"metadata": map[string]interface{}{"version": v.versions[path]},
+		}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -1,22 +1,54 @@
 package main
 
+//go:generate controller-gen object crd:crdVersions=v1 rbac:roleName=cloud-secrets webhook paths=./pkg/apis/...;./controller/...;./store/...;./webhook/... output:crd:dir=config/crd output:rbac:dir=config/rbac output:webhook:dir=config/webhook
+
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/kvendingoldo/cloud-secrets/controller"
+	"github.com/kvendingoldo/cloud-secrets/csi"
+	"github.com/kvendingoldo/cloud-secrets/hook"
 	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/v1alpha1"
 	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/validation"
 	"github.com/kvendingoldo/cloud-secrets/provider"
 	"github.com/kvendingoldo/cloud-secrets/provider/aws"
 	"github.com/kvendingoldo/cloud-secrets/provider/azure"
+	"github.com/kvendingoldo/cloud-secrets/provider/file"
 	"github.com/kvendingoldo/cloud-secrets/provider/google"
+	"github.com/kvendingoldo/cloud-secrets/provider/vault"
+	"github.com/kvendingoldo/cloud-secrets/runner"
+	"github.com/kvendingoldo/cloud-secrets/sink"
+	"github.com/kvendingoldo/cloud-secrets/sink/dotenv"
+	"github.com/kvendingoldo/cloud-secrets/sink/env"
+	"github.com/kvendingoldo/cloud-secrets/sink/kubernetes"
+	"github.com/kvendingoldo/cloud-secrets/sink/template"
+	"github.com/kvendingoldo/cloud-secrets/store"
+	"github.com/kvendingoldo/cloud-secrets/webhook"
 
+	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/go-logr/logr/funcr"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+	csiv1alpha1 "sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
 )
 
 func main() {
@@ -45,10 +77,203 @@ func main() {
 	go serveMetrics(cfg.MetricsAddress)
 	go handleSigterm(cancel)
 
-	var p provider.Provider
+	// The webhook only passes the provider configuration on to the injected containers
+	if cfg.Mode == "webhook" {
+		if err := runWebhook(ctx, cfg); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	// The CSI provider only serves the providers of stores
+	if cfg.Mode == "csi-provider" {
+		if err := runCSIProvider(ctx, cfg); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	// The provider of the operator is optional, CloudSecrets may reference stores instead
+	if cfg.Mode == "operator" {
+		var p provider.Provider
+		if cfg.Provider != "" {
+			p, err = newProvider(cfg)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := runOperator(ctx, cfg, p); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	p, err := newProvider(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch cfg.Mode {
+	case "put":
+		if err := putSecret(ctx, cfg, p); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	case "delete":
+		if err := deleteSecrets(ctx, cfg, p); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	case "copy":
+		if err := copySecrets(ctx, cfg, p); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	case "diff":
+		// Like diff(1), the exit code is 0 if the secrets are equal, 1 if they differ and 2 if the comparison failed
+		differ, err := diffSecrets(ctx, cfg, p)
+		if err != nil {
+			log.Error(err)
+			os.Exit(2)
+		}
+		if differ {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	var sinks []sink.Sink
+	for _, name := range cfg.Sinks {
+		var s sink.Sink
+		switch name {
+		case "dotenv":
+			s, err = dotenv.NewDotenvSink(
+				dotenv.DotenvConfig{
+					Path:     cfg.DotenvPath,
+					FileMode: cfg.DotenvFileMode,
+					Owner:    cfg.DotenvOwner,
+				},
+			)
+		case "template":
+			s, err = template.NewTemplateSink(
+				template.TemplateConfig{
+					Templates: cfg.Templates,
+					FileMode:  cfg.TemplateFileMode,
+					Owner:     cfg.TemplateOwner,
+				},
+			)
+		case "kubernetes":
+			s, err = kubernetes.NewKubernetesSink(
+				kubernetes.KubernetesConfig{
+					Kubeconfig: cfg.KubernetesKubeconfig,
+					Namespace:  cfg.KubernetesNamespace,
+					NamePrefix: cfg.KubernetesNamePrefix,
+					Type:       cfg.KubernetesSecretType,
+					Labels:     cfg.KubernetesLabels,
+					Key:        cfg.KubernetesSecretKey,
+					Provider:   cfg.Provider,
+				},
+			)
+		default:
+			log.Fatalf("unknown sink: %s", name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, s)
+	}
+
+	// In exec mode the secrets are passed to the command as environment variables
+	var envSink *env.EnvSink
+	if len(cfg.Command) > 0 {
+		envSink = env.NewEnvSink()
+		sinks = append(sinks, envSink)
+	}
+
+	secrets, err := secretSpecs(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var hooks []hook.Hook
+	for _, command := range cfg.HookCommands {
+		hooks = append(hooks, hook.NewCommandHook(command))
+	}
+	if cfg.HookSignalPidFile != "" {
+		h, err := hook.NewSignalHook(cfg.HookSignalPidFile, cfg.HookSignal)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hooks = append(hooks, h)
+	}
+	for _, url := range cfg.HookHTTPURLs {
+		hooks = append(hooks, hook.NewHTTPHook(url, cfg.HookHTTPMethod))
+	}
+	for i := range hooks {
+		hooks[i] = hook.WithRetry(hooks[i], cfg.HookTimeout, cfg.HookRetries)
+	}
+
+	// Change detection is skipped in exec mode as the command always needs all secrets
+	var state *controller.State
+	if len(cfg.Command) == 0 {
+		state, err = controller.LoadState(cfg.StateFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctrl := controller.Controller{
+		Provider:    p,
+		Sinks:       sinks,
+		Hooks:       hooks,
+		Interval:    cfg.Interval,
+		Secrets:     secrets,
+		Selector:    selector(cfg),
+		Concurrency: cfg.Concurrency,
+		State:       state,
+	}
+
+	if len(cfg.Command) > 0 {
+		err := ctrl.RunOnce(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		code, err := runner.Run(cfg.Command, envSink.Environ(os.Environ()))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		os.Exit(code)
+	}
+
+	if cfg.Once {
+		err := ctrl.RunOnce(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		os.Exit(0)
+	}
+
+	ctrl.ScheduleRunOnce(time.Now())
+	ctrl.Run(ctx)
+}
+
+// newProvider creates the configured provider
+func newProvider(cfg *cloudsecrets.Config) (provider.Provider, error) {
 	switch cfg.Provider {
 	case "aws":
-		p, err = aws.NewAWSProvider(
+		return aws.NewAWSProvider(
+			aws.AWSConfig{
+				Region:       cfg.AWSRegion,
+				AssumeRole:   cfg.AWSAssumeRole,
+				APIRetries:   cfg.AWSAPIRetries,
+				VersionStage: cfg.AWSVersionStage,
+				ForceDelete:  cfg.AWSForceDelete,
+			},
+		)
+	case "aws-ssm":
+		return aws.NewSSMProvider(
 			aws.AWSConfig{
 				Region:     cfg.AWSRegion,
 				AssumeRole: cfg.AWSAssumeRole,
@@ -56,44 +281,324 @@ func main() {
 			},
 		)
 	case "azure":
-		p, err = azure.NewAzureProvider(
+		return azure.NewAzureProvider(
 			azure.AzureConfig{
 				Region:        cfg.AzureRegion,
 				ResourceGroup: cfg.AzureResourceGroup,
-				KeyVault:      cfg.AzureKeyVault,
+				KeyVaults:     cfg.AzureKeyVaults,
+				VaultURLs:     cfg.AzureVaultURLs,
+				Environment:   cfg.AzureEnvironment,
+
+				AuthMethod:                cfg.AzureAuthMethod,
+				TenantID:                  cfg.AzureTenantID,
+				ClientID:                  cfg.AzureClientID,
+				ClientSecret:              cfg.AzureClientSecret,
+				ClientCertificatePath:     cfg.AzureClientCertificatePath,
+				ClientCertificatePassword: cfg.AzureClientCertificatePassword,
+				FederatedTokenFile:        cfg.AzureFederatedTokenFile,
 			},
 		)
 	case "google":
-		p, err = google.NewGoogleProvider(
+		return google.NewGoogleProvider(
 			google.GoogleConfig{
 				ProjectId:     cfg.GCPProjectId,
 				SecretVersion: cfg.GCPSecretVersion,
+
+				CredentialsFile:           cfg.GCPCredentialsFile,
+				ImpersonateServiceAccount: cfg.GCPImpersonateServiceAccount,
+				ImpersonateDelegates:      cfg.GCPImpersonateDelegates,
+				Endpoint:                  cfg.GCPEndpoint,
+				Insecure:                  cfg.GCPEndpointInsecure,
+				FallbackToEnabled:         cfg.GCPVersionFallback,
+			},
+		)
+	case "vault":
+		return vault.NewVaultProvider(
+			vault.VaultConfig{
+				Address:       cfg.VaultAddress,
+				Namespace:     cfg.VaultNamespace,
+				MountPath:     cfg.VaultMountPath,
+				KVVersion:     cfg.VaultKVVersion,
+				SecretVersion: cfg.VaultSecretVersion,
+				AuthMethod:    cfg.VaultAuthMethod,
+				Token:         cfg.VaultToken,
+				AuthMountPath: cfg.VaultAuthMountPath,
+				RoleID:        cfg.VaultRoleID,
+				SecretID:      cfg.VaultSecretID,
+				Role:          cfg.VaultRole,
+				TokenPath:     cfg.VaultKubernetesTokenPath,
+			},
+		)
+	case "file":
+		return file.NewFileProvider(
+			file.FileConfig{
+				Path: cfg.FilePath,
 			},
 		)
 	default:
-		log.Fatalf("unknown provider: %s", cfg.Provider)
+		return nil, fmt.Errorf("unknown provider: %s", cfg.Provider)
+	}
+}
+
+// secretSpecs returns the secrets given by name and listed in the secrets file
+func secretSpecs(cfg *cloudsecrets.Config) ([]cloudsecrets.SecretSpec, error) {
+	var secrets []cloudsecrets.SecretSpec
+	for _, name := range cfg.SecretNames {
+		secrets = append(secrets, cloudsecrets.SecretSpec{Name: name})
+	}
+	if cfg.SecretsFile != "" {
+		specs, err := cloudsecrets.LoadSecretsFile(cfg.SecretsFile)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, specs...)
 	}
+
+	return secrets, nil
+}
+
+// selector returns the configured secret selector, nil if none is configured
+func selector(cfg *cloudsecrets.Config) *provider.Selector {
+	if len(cfg.SelectorTags) == 0 && cfg.SelectorNamePrefix == "" {
+		return nil
+	}
+
+	return &provider.Selector{
+		Tags:       cfg.SelectorTags,
+		NamePrefix: cfg.SelectorNamePrefix,
+	}
+}
+
+// copySecrets copies the secrets from the source provider p to the destination provider
+func copySecrets(ctx context.Context, cfg *cloudsecrets.Config, p provider.Provider) error {
+	destination, err := newProvider(cfg.Target())
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	ctrl := controller.Controller{
-		Provider:   p,
-		Interval:   cfg.Interval,
-		SecretName: cfg.SecretName,
+	secrets, err := secretSpecs(cfg)
+	if err != nil {
+		return err
 	}
 
-	if cfg.Once {
-		err := ctrl.RunOnce(ctx)
+	copier := controller.Copier{
+		Source:      p,
+		Destination: destination,
+		Secrets:     secrets,
+		Selector:    selector(cfg),
+		Conflict:    cfg.CopyConflict,
+		DryRun:      cfg.CopyDryRun,
+	}
+
+	return copier.Run(ctx)
+}
+
+// diffSecrets compares the secrets of the provider p with the target provider and reports whether they differ
+func diffSecrets(ctx context.Context, cfg *cloudsecrets.Config, p provider.Provider) (bool, error) {
+	target, err := newProvider(cfg.Target())
+	if err != nil {
+		return false, err
+	}
+
+	secrets, err := secretSpecs(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	differ := controller.Differ{
+		Source:     p,
+		Target:     target,
+		Secrets:    secrets,
+		Selector:   selector(cfg),
+		ShowValues: cfg.DiffShowValues,
+	}
+
+	return differ.Run(ctx, os.Stdout)
+}
+
+// runOperator reconciles CloudSecret resources until ctx is canceled
+func runOperator(ctx context.Context, cfg *cloudsecrets.Config, p provider.Provider) error {
+	setupControllerLogger()
+
+	config, err := clientcmd.BuildConfigFromFlags("", cfg.KubernetesKubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+
+	scheme, err := newScheme()
+	if err != nil {
+		return err
+	}
+
+	options := ctrl.Options{
+		Scheme: scheme,
+		// Metrics are served by serveMetrics
+		Metrics:          metricsserver.Options{BindAddress: "0"},
+		LeaderElection:   cfg.OperatorLeaderElection,
+		LeaderElectionID: "cloud-secrets.kvendingoldo.io",
+	}
+	if cfg.OperatorNamespace != "" {
+		options.Cache.DefaultNamespaces = map[string]cache.Config{cfg.OperatorNamespace: {}}
+	}
+
+	mgr, err := ctrl.NewManager(config, options)
+	if err != nil {
+		return fmt.Errorf("failed to setup manager: %w", err)
+	}
+
+	reconciler := &controller.CloudSecretReconciler{
+		Client:             mgr.GetClient(),
+		Providers:          map[string]provider.Provider{},
+		DefaultProvider:    cfg.Provider,
+		ProviderNamespaces: cfg.OperatorProviderNamespaces,
+		Stores:             store.NewManager(mgr.GetClient(), cfg),
+		Interval:           cfg.Interval,
+	}
+	if p != nil {
+		reconciler.Providers[cfg.Provider] = p
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		return err
+	}
+
+	return mgr.Start(ctx)
+}
+
+// newScheme returns a scheme of the Kubernetes and cloud-secrets resources
+func newScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return scheme, nil
+}
+
+// runCSIProvider serves the provider service of the Secrets Store CSI Driver until ctx is canceled
+func runCSIProvider(ctx context.Context, cfg *cloudsecrets.Config) error {
+	config, err := clientcmd.BuildConfigFromFlags("", cfg.KubernetesKubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+	scheme, err := newScheme()
+	if err != nil {
+		return err
+	}
+	// Stores are read on every mount, which is rare enough to not need a cache
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to setup kubernetes client: %w", err)
+	}
+
+	// A socket left behind by a previous run prevents listening
+	if err := os.Remove(cfg.CSIEndpoint); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	listener, err := net.Listen("unix", cfg.CSIEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.CSIEndpoint, err)
+	}
+
+	server := grpc.NewServer()
+	csiv1alpha1.RegisterCSIDriverProviderServer(server, &csi.Server{
+		Stores: store.NewManager(c, cfg),
+	})
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	log.Infof("Serving CSI provider on %s", cfg.CSIEndpoint)
+	return server.Serve(listener)
+}
+
+// runWebhook serves the pod injection webhook until ctx is canceled
+func runWebhook(ctx context.Context, cfg *cloudsecrets.Config) error {
+	setupControllerLogger()
+
+	server := ctrlwebhook.NewServer(ctrlwebhook.Options{
+		Port:    cfg.WebhookPort,
+		CertDir: cfg.WebhookCertDir,
+	})
+	server.Register(webhook.Path, &ctrlwebhook.Admission{
+		Handler: &webhook.PodInjector{
+			Image:        cfg.WebhookImage,
+			MountPath:    cfg.WebhookMountPath,
+			ProviderArgs: cfg.ProviderArgs(),
+		},
+	})
+
+	log.Infof("Serving webhook on port %d", cfg.WebhookPort)
+	return server.Start(ctx)
+}
+
+// setupControllerLogger sends the logs of controller-runtime to logrus
+func setupControllerLogger() {
+	ctrl.SetLogger(funcr.New(func(prefix, args string) {
+		log.Info(prefix, " ", args)
+	}, funcr.Options{}))
+}
+
+// putSecret creates the secret, or adds a new version if it already exists
+func putSecret(ctx context.Context, cfg *cloudsecrets.Config, p provider.Provider) error {
+	writer, ok := p.(provider.SecretWriter)
+	if !ok {
+		return fmt.Errorf("provider %s does not support writing secrets", cfg.Provider)
+	}
+
+	value := []byte(cfg.PutValue)
+	if cfg.PutValueFile != "" {
+		var err error
+		if cfg.PutValueFile == "-" {
+			value, err = io.ReadAll(os.Stdin)
+		} else {
+			value, err = os.ReadFile(cfg.PutValueFile)
+		}
 		if err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("failed to read secret value: %w", err)
 		}
+	}
 
-		os.Exit(0)
+	name := cfg.SecretNames[0]
+	version, err := writer.CreateSecret(ctx, name, value, cfg.PutTags)
+	if errors.Is(err, provider.ErrSecretExists) {
+		// The tags of existing secrets are replaced, like the tags of created ones are set
+		var setter provider.TagSetter
+		if len(cfg.PutTags) > 0 {
+			if setter, ok = p.(provider.TagSetter); !ok {
+				return fmt.Errorf("provider %s does not support setting the tags of existing secrets", cfg.Provider)
+			}
+		}
+
+		version, err = writer.UpdateSecret(ctx, name, value)
+		if err == nil && setter != nil {
+			err = setter.SetSecretTags(ctx, name, cfg.PutTags)
+		}
+	}
+	if err != nil {
+		return err
 	}
 
-	ctrl.ScheduleRunOnce(time.Now())
-	ctrl.Run(ctx)
+	log.Infof("Stored secret %s (version: %s)", name, version)
+	return nil
+}
+
+func deleteSecrets(ctx context.Context, cfg *cloudsecrets.Config, p provider.Provider) error {
+	writer, ok := p.(provider.SecretWriter)
+	if !ok {
+		return fmt.Errorf("provider %s does not support deleting secrets", cfg.Provider)
+	}
+
+	for _, name := range cfg.SecretNames {
+		if err := writer.DeleteSecret(ctx, name); err != nil {
+			return err
+		}
+		log.Infof("Deleted secret %s", name)
+	}
+
+	return nil
 }
 
 func handleSigterm(cancel func()) {
@@ -110,5 +615,7 @@ func serveMetrics(address string) {
 		w.Write([]byte("OK"))
 	})
 
+	http.Handle("/metrics", promhttp.Handler())
+
 	log.Fatal(http.ListenAndServe(address, nil))
 }
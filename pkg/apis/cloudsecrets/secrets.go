@@ -0,0 +1,51 @@
+package cloudsecrets
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretSpec describes a single secret to synchronize
+type SecretSpec struct {
+	// Name of the secret in the provider
+	Name string `yaml:"name"`
+	// Alias replaces the name of the secret in sinks, e.g. to name the variable of a non-JSON secret (optional)
+	Alias string `yaml:"alias,omitempty"`
+	// Version selects a provider specific version of the secret (optional),
+	// e.g. a GCP version number or alias, an AWS version ID or staging label (AWSPENDING, custom labels are prefixed with stage:)
+	Version string `yaml:"version,omitempty"`
+}
+
+// SecretsFile is the mapping file passed via --secrets-file
+type SecretsFile struct {
+	Secrets []SecretSpec `yaml:"secrets"`
+}
+
+// LoadSecretsFile reads the secret specs from a YAML (or JSON) mapping file, e.g.
+//
+//	secrets:
+//	  - name: prod/db
+//	    alias: db
+//	  - name: prod/api-key
+//	    version: "3"
+func LoadSecretsFile(path string) ([]SecretSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	var file SecretsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file %s: %w", path, err)
+	}
+
+	for i, spec := range file.Secrets {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("secrets file %s: secret #%d has no name", path, i+1)
+		}
+	}
+
+	return file.Secrets, nil
+}
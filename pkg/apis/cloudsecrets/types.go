@@ -1,63 +1,346 @@
 package cloudsecrets
 
 import (
+	"fmt"
 	"github.com/alecthomas/kingpin"
 	"github.com/sirupsen/logrus"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 var (
 	// Version is the current version of the app, generated at build time
 	Version = "unknown"
+
+	// Providers are the supported providers
+	Providers = []string{"aws", "aws-ssm", "azure", "google", "vault", "file"}
+	// WriteProviders are the providers supporting put, delete and copy, i.e. implementing provider.SecretWriter
+	WriteProviders = []string{"aws", "azure", "google"}
 )
 
 type Config struct {
-	SecretName     string
+	// Mode is the selected command: sync, put, delete, copy, diff, operator, webhook or csi-provider
+	Mode string
+
+	SecretNames []string
+	SecretsFile string
+	Concurrency int
+
+	SelectorTags       map[string]string
+	SelectorNamePrefix string
+
 	Provider       string
 	LogFormat      string
 	LogLevel       string
 	MetricsAddress string
 
-	Interval time.Duration
-	Once     bool
+	Interval  time.Duration
+	Once      bool
+	Command   []string
+	StateFile string
+
+	PutValue     string
+	PutValueFile string
+	PutTags      map[string]string
+
+	CopyConflict string
+	CopyDryRun   bool
+
+	DiffShowValues bool
+
+	OperatorNamespace      string
+	OperatorLeaderElection bool
+	// OperatorProviderNamespaces may use the provider of the operator, CloudSecrets in other namespaces have to reference a store
+	OperatorProviderNamespaces []string
+
+	WebhookPort      int
+	WebhookCertDir   string
+	WebhookImage     string
+	WebhookMountPath string
 
-	AWSRegion     string
-	AWSAssumeRole string
-	AWSAPIRetries int
+	CSIEndpoint string
+
+	// The target provider of the copy and diff commands, the Target* options override the provider options for it
+	TargetProvider       string
+	TargetAWSRegion      string
+	TargetAWSAssumeRole  string
+	TargetAzureKeyVaults []string
+	TargetGCPProjectId   string
+	TargetVaultNamespace string
+	TargetVaultMountPath string
+	TargetFilePath       string
+
+	AWSRegion       string
+	AWSAssumeRole   string
+	AWSAPIRetries   int
+	AWSVersionStage string
+	AWSForceDelete  bool
 
 	AzureRegion        string
 	AzureResourceGroup string
-	AzureKeyVault      string
+	AzureKeyVaults     []string
+	AzureVaultURLs     []string
+	AzureEnvironment   string
+
+	AzureAuthMethod                string
+	AzureTenantID                  string
+	AzureClientID                  string
+	AzureClientSecret              string
+	AzureClientCertificatePath     string
+	AzureClientCertificatePassword string
+	AzureFederatedTokenFile        string
 
 	GCPProjectId     string
 	GCPSecretVersion string
+
+	GCPCredentialsFile           string
+	GCPImpersonateServiceAccount string
+	GCPImpersonateDelegates      []string
+	GCPEndpoint                  string
+	GCPEndpointInsecure          bool
+	GCPVersionFallback           bool
+
+	VaultAddress             string
+	VaultNamespace           string
+	VaultMountPath           string
+	VaultKVVersion           int
+	VaultSecretVersion       int
+	VaultAuthMethod          string
+	VaultToken               string
+	VaultAuthMountPath       string
+	VaultRoleID              string
+	VaultSecretID            string
+	VaultRole                string
+	VaultKubernetesTokenPath string
+
+	FilePath string
+
+	Sinks []string
+
+	DotenvPath     string
+	DotenvFileMode string
+	DotenvOwner    string
+
+	Templates        []string
+	TemplateFileMode string
+	TemplateOwner    string
+
+	KubernetesKubeconfig string
+	KubernetesNamespace  string
+	KubernetesNamePrefix string
+	KubernetesSecretType string
+	KubernetesLabels     map[string]string
+	KubernetesSecretKey  string
+
+	HookCommands      []string
+	HookSignalPidFile string
+	HookSignal        string
+	HookHTTPURLs      []string
+	HookHTTPMethod    string
+	HookTimeout       time.Duration
+	HookRetries       int
 }
 
 var defaultConfig = &Config{
-	SecretName:     "",
+	Mode: "sync",
+
+	SecretsFile: "",
+	Concurrency: 4,
+
+	SelectorNamePrefix: "",
+
 	Provider:       "",
 	LogFormat:      "text",
 	LogLevel:       logrus.InfoLevel.String(),
 	MetricsAddress: ":7979",
 
-	Interval: time.Minute,
-	Once:     true,
+	Interval:  time.Minute,
+	Once:      true,
+	StateFile: "",
+
+	CopyConflict: "skip",
+	CopyDryRun:   false,
+
+	DiffShowValues: false,
+
+	OperatorNamespace:      "",
+	OperatorLeaderElection: false,
 
-	AWSRegion:     "us-east-1",
-	AWSAssumeRole: "",
-	AWSAPIRetries: 3,
+	WebhookPort:      9443,
+	WebhookCertDir:   "/tmp/k8s-webhook-server/serving-certs",
+	WebhookImage:     "",
+	WebhookMountPath: "/var/run/secrets/cloud-secrets",
 
-	AzureRegion: "centralus",
+	CSIEndpoint: "/var/run/secrets-store-csi-providers/cloud-secrets.sock",
+
+	AWSRegion:       "us-east-1",
+	AWSAssumeRole:   "",
+	AWSAPIRetries:   3,
+	AWSVersionStage: "AWSCURRENT",
+	AWSForceDelete:  false,
+
+	AzureRegion:      "centralus",
+	AzureEnvironment: "AzurePublicCloud",
+	AzureAuthMethod:  "cli",
 
 	GCPProjectId:     "",
 	GCPSecretVersion: "latest",
+
+	GCPCredentialsFile:           "",
+	GCPImpersonateServiceAccount: "",
+	GCPEndpoint:                  "",
+	GCPEndpointInsecure:          false,
+	GCPVersionFallback:           false,
+
+	VaultAddress:             "",
+	VaultNamespace:           "",
+	VaultMountPath:           "secret",
+	VaultKVVersion:           2,
+	VaultSecretVersion:       0,
+	VaultAuthMethod:          "token",
+	VaultAuthMountPath:       "",
+	VaultRole:                "",
+	VaultKubernetesTokenPath: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+
+	FilePath: "",
+
+	DotenvPath:     ".env",
+	DotenvFileMode: "0600",
+	DotenvOwner:    "",
+
+	TemplateFileMode: "0600",
+	TemplateOwner:    "",
+
+	KubernetesKubeconfig: "",
+	KubernetesNamespace:  "",
+	KubernetesNamePrefix: "",
+	KubernetesSecretType: "Opaque",
+	KubernetesSecretKey:  "value",
+
+	HookSignalPidFile: "",
+	HookSignal:        "SIGHUP",
+	HookHTTPMethod:    http.MethodPost,
+	HookTimeout:       30 * time.Second,
+	HookRetries:       3,
 }
 
 func NewConfig() *Config {
 	return &Config{}
 }
 
+// String returns the config with credentials redacted, so it can be logged
+func (cfg *Config) String() string {
+	redacted := *cfg
+	for _, value := range []*string{
+		&redacted.PutValue,
+		&redacted.VaultToken,
+		&redacted.VaultSecretID,
+		&redacted.AzureClientSecret,
+		&redacted.AzureClientCertificatePassword,
+	} {
+		if *value != "" {
+			*value = "*****"
+		}
+	}
+
+	return fmt.Sprintf("%+v", redacted)
+}
+
+// Target returns the configuration of the target provider of the copy and diff commands,
+// which is the configuration with the target provider and options applied.
+func (cfg *Config) Target() *Config {
+	target := *cfg
+	if cfg.TargetProvider != "" {
+		target.Provider = cfg.TargetProvider
+	}
+	if cfg.TargetAWSRegion != "" {
+		target.AWSRegion = cfg.TargetAWSRegion
+	}
+	if cfg.TargetAWSAssumeRole != "" {
+		target.AWSAssumeRole = cfg.TargetAWSAssumeRole
+	}
+	if len(cfg.TargetAzureKeyVaults) > 0 {
+		target.AzureKeyVaults = cfg.TargetAzureKeyVaults
+		target.AzureVaultURLs = nil
+	}
+	if cfg.TargetGCPProjectId != "" {
+		target.GCPProjectId = cfg.TargetGCPProjectId
+	}
+	if cfg.TargetVaultNamespace != "" {
+		target.VaultNamespace = cfg.TargetVaultNamespace
+	}
+	if cfg.TargetVaultMountPath != "" {
+		target.VaultMountPath = cfg.TargetVaultMountPath
+	}
+	if cfg.TargetFilePath != "" {
+		target.FilePath = cfg.TargetFilePath
+	}
+	return &target
+}
+
+// targetFlags adds the flags overriding provider options for the target provider to cmd
+func (cfg *Config) targetFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("to-aws-region", "The AWS region of the target provider (default: --aws-region)").StringVar(&cfg.TargetAWSRegion)
+	cmd.Flag("to-aws-assume-role", "The IAM role to assume for the target provider, e.g. of another account (default: --aws-assume-role)").StringVar(&cfg.TargetAWSAssumeRole)
+	cmd.Flag("to-azure-key-vault", "Name of a Key Vault of the target provider; specify multiple times for multiple vaults (default: --azure-key-vault)").StringsVar(&cfg.TargetAzureKeyVaults)
+	cmd.Flag("to-gcp-project-id", "The GCP project of the target provider (default: --gcp-project-id)").StringVar(&cfg.TargetGCPProjectId)
+	cmd.Flag("to-vault-namespace", "The Vault namespace of the target provider (default: --vault-namespace)").StringVar(&cfg.TargetVaultNamespace)
+	cmd.Flag("to-vault-mount-path", "The mount path of the KV secrets engine of the target provider (default: --vault-mount-path)").StringVar(&cfg.TargetVaultMountPath)
+	cmd.Flag("to-file-path", "The directory or document of the target provider (default: --file-path)").StringVar(&cfg.TargetFilePath)
+}
+
+// ProviderArgs returns the flags configuring the provider of cfg, e.g. for the containers injected by the webhook.
+// Credentials are left out, the containers authenticate with the service account of their pod instead.
+func (cfg *Config) ProviderArgs() []string {
+	args := []string{"--provider", cfg.Provider}
+	add := func(flag string, values ...string) {
+		for _, value := range values {
+			if value != "" {
+				args = append(args, "--"+flag, value)
+			}
+		}
+	}
+
+	switch cfg.Provider {
+	case "aws", "aws-ssm":
+		add("aws-region", cfg.AWSRegion)
+		add("aws-assume-role", cfg.AWSAssumeRole)
+		add("aws-version-stage", cfg.AWSVersionStage)
+	case "azure":
+		add("azure-key-vault", cfg.AzureKeyVaults...)
+		add("azure-vault-url", cfg.AzureVaultURLs...)
+		add("azure-environment", cfg.AzureEnvironment)
+		add("azure-auth-method", cfg.AzureAuthMethod)
+		add("azure-tenant-id", cfg.AzureTenantID)
+		add("azure-client-id", cfg.AzureClientID)
+	case "google":
+		add("gcp-project-id", cfg.GCPProjectId)
+		add("gcp-secret-version", cfg.GCPSecretVersion)
+		add("gcp-impersonate-service-account", cfg.GCPImpersonateServiceAccount)
+		add("gcp-impersonate-delegate", cfg.GCPImpersonateDelegates...)
+		if cfg.GCPVersionFallback {
+			args = append(args, "--gcp-version-fallback")
+		}
+	case "vault":
+		add("vault-address", cfg.VaultAddress)
+		add("vault-namespace", cfg.VaultNamespace)
+		add("vault-mount-path", cfg.VaultMountPath)
+		add("vault-kv-version", strconv.Itoa(cfg.VaultKVVersion))
+		if cfg.VaultSecretVersion != 0 {
+			add("vault-secret-version", strconv.Itoa(cfg.VaultSecretVersion))
+		}
+		add("vault-auth-method", cfg.VaultAuthMethod)
+		add("vault-auth-mount-path", cfg.VaultAuthMountPath)
+		add("vault-role", cfg.VaultRole)
+	case "file":
+		add("file-path", cfg.FilePath)
+	}
+
+	return args
+}
+
 // allLogLevelsAsStrings returns all logrus levels as a list of strings
 func allLogLevelsAsStrings() []string {
 	var levels []string
@@ -73,22 +356,85 @@ func (cfg *Config) ParseFlags(args []string) error {
 	app.DefaultEnvars()
 
 	// Flags related to processing sources
-	app.Flag("secret-name", "Name of secret").Default(defaultConfig.SecretName).StringVar(&cfg.SecretName)
+	app.Flag("secret-name", "Name of secret; specify multiple times for multiple secrets").StringsVar(&cfg.SecretNames)
+	app.Flag("secrets-file", "Path to a YAML file listing the secrets to synchronize (optional)").Default(defaultConfig.SecretsFile).StringVar(&cfg.SecretsFile)
+	app.Flag("selector-tag", "Synchronize all secrets having this tag (label in GCP) in the form key=value; specify multiple times to require multiple tags").StringMapVar(&cfg.SelectorTags)
+	app.Flag("selector-name-prefix", "Synchronize all secrets whose name starts with this prefix (optional)").Default(defaultConfig.SelectorNamePrefix).StringVar(&cfg.SelectorNamePrefix)
+	app.Flag("concurrency", "The maximum number of secrets fetched in parallel (default: 4)").Default(strconv.Itoa(defaultConfig.Concurrency)).IntVar(&cfg.Concurrency)
 
 	// Flags related to providers
-	app.Flag("provider", "The Cloud provider (required, options: aws, azure, google)").Required().PlaceHolder("provider").EnumVar(&cfg.Provider, "aws", "azure", "google")
-	// AWS
+	app.Flag("provider", "The Cloud provider (required except for operator and csi-provider, options: "+strings.Join(Providers, ", ")+")").PlaceHolder("provider").EnumVar(&cfg.Provider, Providers...)
+	// AWS, also used by aws-ssm
 	app.Flag("aws-region", "").Default(defaultConfig.AWSRegion).StringVar(&cfg.AWSRegion)
 	app.Flag("aws-assume-role", "When using the AWS provider, assume this IAM role. Useful for hosted zones in another AWS account. Specify the full ARN (optional)").Default(defaultConfig.AWSAssumeRole).StringVar(&cfg.AWSAssumeRole)
 	app.Flag("aws-api-retries", "When using the AWS provider, set the maximum number of retries for API calls before giving up.").Default(strconv.Itoa(defaultConfig.AWSAPIRetries)).IntVar(&cfg.AWSAPIRetries)
+	app.Flag("aws-version-stage", "When using the AWS provider, the default staging label of secrets, e.g. AWSPENDING to canary rotated credentials (default: AWSCURRENT)").Default(defaultConfig.AWSVersionStage).StringVar(&cfg.AWSVersionStage)
+	app.Flag("aws-force-delete", "When using the AWS provider, delete secrets immediately instead of after the recovery window (default: disabled)").Default(strconv.FormatBool(defaultConfig.AWSForceDelete)).BoolVar(&cfg.AWSForceDelete)
 	// Azure
 	app.Flag("azure-region", "").Default(defaultConfig.AzureRegion).StringVar(&cfg.AzureRegion)
-	app.Flag("azure-key-vault", "").StringVar(&cfg.AzureKeyVault)
+	app.Flag("azure-key-vault", "Name of the Key Vault; specify multiple times for multiple vaults, secrets may then be qualified as vault/secret").StringsVar(&cfg.AzureKeyVaults)
+	app.Flag("azure-vault-url", "URL of a Key Vault, overriding the URL derived from the vault name and environment; specify multiple times for multiple vaults").StringsVar(&cfg.AzureVaultURLs)
+	app.Flag("azure-environment", "The Azure cloud (default: AzurePublicCloud, options: AzurePublicCloud, AzureUSGovernmentCloud, AzureChinaCloud, AzureGermanCloud)").Default(defaultConfig.AzureEnvironment).EnumVar(&cfg.AzureEnvironment, "AzurePublicCloud", "AzureUSGovernmentCloud", "AzureChinaCloud", "AzureGermanCloud")
 	app.Flag("azure-resource-group", "").StringVar(&cfg.AzureResourceGroup)
+	app.Flag("azure-auth-method", "When using the Azure provider, how to authenticate (default: cli, options: cli, client-secret, client-certificate, managed-identity, workload-identity)").Default(defaultConfig.AzureAuthMethod).EnumVar(&cfg.AzureAuthMethod, "cli", "client-secret", "client-certificate", "managed-identity", "workload-identity")
+	app.Flag("azure-tenant-id", "When using the Azure provider, the tenant of the service principal (default: $AZURE_TENANT_ID)").StringVar(&cfg.AzureTenantID)
+	app.Flag("azure-client-id", "When using the Azure provider, the client ID of the service principal or user-assigned managed identity (default: $AZURE_CLIENT_ID, except for managed-identity)").StringVar(&cfg.AzureClientID)
+	app.Flag("azure-client-secret", "When using the client-secret auth method, the client secret (default: $AZURE_CLIENT_SECRET)").StringVar(&cfg.AzureClientSecret)
+	app.Flag("azure-client-certificate-path", "When using the client-certificate auth method, the path of the PKCS#12 certificate (default: $AZURE_CERTIFICATE_PATH)").StringVar(&cfg.AzureClientCertificatePath)
+	app.Flag("azure-client-certificate-password", "When using the client-certificate auth method, the password of the certificate (default: $AZURE_CERTIFICATE_PASSWORD)").StringVar(&cfg.AzureClientCertificatePassword)
+	app.Flag("azure-federated-token-file", "When using the workload-identity auth method, the path of the federated token (default: $AZURE_FEDERATED_TOKEN_FILE)").StringVar(&cfg.AzureFederatedTokenFile)
 	// Google
 	app.Flag("gcp-project-id", "").Default(defaultConfig.GCPProjectId).StringVar(&cfg.GCPProjectId)
 
-	app.Flag("gcp-secret-version", "").Default(defaultConfig.GCPSecretVersion).StringVar(&cfg.GCPSecretVersion)
+	app.Flag("gcp-secret-version", "When using the Google provider, the default version of secrets: a version number, latest or a version alias (default: latest)").Default(defaultConfig.GCPSecretVersion).StringVar(&cfg.GCPSecretVersion)
+	app.Flag("gcp-version-fallback", "When using the Google provider, fall back to the most recent enabled version if the requested version is disabled or destroyed (default: disabled)").Default(strconv.FormatBool(defaultConfig.GCPVersionFallback)).BoolVar(&cfg.GCPVersionFallback)
+	app.Flag("gcp-credentials-file", "When using the Google provider, the credentials JSON file (default: application default credentials)").Default(defaultConfig.GCPCredentialsFile).StringVar(&cfg.GCPCredentialsFile)
+	app.Flag("gcp-impersonate-service-account", "When using the Google provider, impersonate this service account (optional)").Default(defaultConfig.GCPImpersonateServiceAccount).StringVar(&cfg.GCPImpersonateServiceAccount)
+	app.Flag("gcp-impersonate-delegate", "When impersonating a service account, a service account of the delegation chain; specify multiple times in chain order (optional)").StringsVar(&cfg.GCPImpersonateDelegates)
+	app.Flag("gcp-endpoint", "When using the Google provider, override the Secret Manager API endpoint, e.g. localhost:8085 for an emulator (optional)").Default(defaultConfig.GCPEndpoint).StringVar(&cfg.GCPEndpoint)
+	app.Flag("gcp-endpoint-insecure", "When using the Google provider, connect to the endpoint without TLS and authentication, only intended for emulators (default: disabled)").Default(strconv.FormatBool(defaultConfig.GCPEndpointInsecure)).BoolVar(&cfg.GCPEndpointInsecure)
+	// Vault
+	app.Flag("vault-address", "When using the Vault provider, the address of the Vault server (default: $VAULT_ADDR)").Default(defaultConfig.VaultAddress).StringVar(&cfg.VaultAddress)
+	app.Flag("vault-namespace", "When using the Vault provider, the Vault Enterprise namespace (optional)").Default(defaultConfig.VaultNamespace).StringVar(&cfg.VaultNamespace)
+	app.Flag("vault-mount-path", "When using the Vault provider, the mount path of the KV secrets engine (default: secret)").Default(defaultConfig.VaultMountPath).StringVar(&cfg.VaultMountPath)
+	app.Flag("vault-kv-version", "When using the Vault provider, the version of the KV secrets engine (default: 2, options: 1, 2)").Default(strconv.Itoa(defaultConfig.VaultKVVersion)).IntVar(&cfg.VaultKVVersion)
+	app.Flag("vault-secret-version", "When using the Vault provider with KV v2, pin secrets to this version (default: 0, the latest version)").Default(strconv.Itoa(defaultConfig.VaultSecretVersion)).IntVar(&cfg.VaultSecretVersion)
+	app.Flag("vault-auth-method", "When using the Vault provider, the auth method (default: token, options: token, approle, kubernetes)").Default(defaultConfig.VaultAuthMethod).EnumVar(&cfg.VaultAuthMethod, "token", "approle", "kubernetes")
+	app.Flag("vault-token", "When using the token auth method, the Vault token (default: $VAULT_TOKEN)").StringVar(&cfg.VaultToken)
+	app.Flag("vault-auth-mount-path", "When using the approle or kubernetes auth method, the mount path of the auth method (default: the auth method name)").Default(defaultConfig.VaultAuthMountPath).StringVar(&cfg.VaultAuthMountPath)
+	app.Flag("vault-role-id", "When using the approle auth method, the role ID").StringVar(&cfg.VaultRoleID)
+	app.Flag("vault-secret-id", "When using the approle auth method, the secret ID").StringVar(&cfg.VaultSecretID)
+	app.Flag("vault-role", "When using the kubernetes auth method, the Vault role to log in with").Default(defaultConfig.VaultRole).StringVar(&cfg.VaultRole)
+	app.Flag("vault-kubernetes-token-path", "When using the kubernetes auth method, the path of the service account token").Default(defaultConfig.VaultKubernetesTokenPath).StringVar(&cfg.VaultKubernetesTokenPath)
+	// File, for development and tests
+	app.Flag("file-path", "When using the file provider, a directory with a file per secret or a JSON or YAML document mapping secret names to values").Default(defaultConfig.FilePath).StringVar(&cfg.FilePath)
+
+	// Flags related to sinks
+	app.Flag("sink", "Where to write fetched secrets; specify multiple times for multiple sinks (optional, options: dotenv, template, kubernetes)").EnumsVar(&cfg.Sinks, "dotenv", "template", "kubernetes")
+	// Dotenv
+	app.Flag("dotenv-path", "When using the dotenv sink, the path of the file to write (default: .env)").Default(defaultConfig.DotenvPath).StringVar(&cfg.DotenvPath)
+	app.Flag("dotenv-file-mode", "When using the dotenv sink, the octal permissions of the written file (default: 0600)").Default(defaultConfig.DotenvFileMode).StringVar(&cfg.DotenvFileMode)
+	app.Flag("dotenv-owner", "When using the dotenv sink, the owner of the written file in the form user[:group] (optional)").Default(defaultConfig.DotenvOwner).StringVar(&cfg.DotenvOwner)
+	// Template
+	app.Flag("template", "When using the template sink, a Go template to render in the form source:destination; specify multiple times for multiple templates").StringsVar(&cfg.Templates)
+	app.Flag("template-file-mode", "When using the template sink, the octal permissions of the rendered files (default: 0600)").Default(defaultConfig.TemplateFileMode).StringVar(&cfg.TemplateFileMode)
+	app.Flag("template-owner", "When using the template sink, the owner of the rendered files in the form user[:group] (optional)").Default(defaultConfig.TemplateOwner).StringVar(&cfg.TemplateOwner)
+	// Kubernetes
+	app.Flag("kubernetes-kubeconfig", "When using the kubernetes sink, the path of the kubeconfig file (default: in-cluster config)").Default(defaultConfig.KubernetesKubeconfig).StringVar(&cfg.KubernetesKubeconfig)
+	app.Flag("kubernetes-namespace", "When using the kubernetes sink, the namespace of the Secrets (default: the namespace of the pod)").Default(defaultConfig.KubernetesNamespace).StringVar(&cfg.KubernetesNamespace)
+	app.Flag("kubernetes-name-prefix", "When using the kubernetes sink, a prefix of the Secret names, which are derived from the secret names or aliases (optional)").Default(defaultConfig.KubernetesNamePrefix).StringVar(&cfg.KubernetesNamePrefix)
+	app.Flag("kubernetes-secret-type", "When using the kubernetes sink, the type of the Secrets (default: Opaque)").Default(defaultConfig.KubernetesSecretType).StringVar(&cfg.KubernetesSecretType)
+	app.Flag("kubernetes-label", "When using the kubernetes sink, a label of the Secrets in the form key=value; specify multiple times for multiple labels (optional)").StringMapVar(&cfg.KubernetesLabels)
+	app.Flag("kubernetes-secret-key", "When using the kubernetes sink, the data key of secrets which are not JSON objects (default: value)").Default(defaultConfig.KubernetesSecretKey).StringVar(&cfg.KubernetesSecretKey)
+
+	// Flags related to hooks, which run after secrets changed
+	app.Flag("hook-command", "Shell command to run after secrets changed; specify multiple times for multiple commands (optional)").StringsVar(&cfg.HookCommands)
+	app.Flag("hook-signal-pidfile", "Send --hook-signal to the process whose PID is stored in this file after secrets changed (optional)").Default(defaultConfig.HookSignalPidFile).StringVar(&cfg.HookSignalPidFile)
+	app.Flag("hook-signal", "The signal sent to the process of --hook-signal-pidfile (default: SIGHUP)").Default(defaultConfig.HookSignal).StringVar(&cfg.HookSignal)
+	app.Flag("hook-http-url", "URL to send a request to after secrets changed; specify multiple times for multiple URLs (optional)").StringsVar(&cfg.HookHTTPURLs)
+	app.Flag("hook-http-method", "The HTTP method used for --hook-http-url (default: POST)").Default(defaultConfig.HookHTTPMethod).StringVar(&cfg.HookHTTPMethod)
+	app.Flag("hook-timeout", "The timeout of a single hook attempt in duration format (default: 30s)").Default(defaultConfig.HookTimeout.String()).DurationVar(&cfg.HookTimeout)
+	app.Flag("hook-retries", "The maximum number of retries of a failed hook (default: 3)").Default(strconv.Itoa(defaultConfig.HookRetries)).IntVar(&cfg.HookRetries)
 
 	// Miscellaneous flags
 	app.Flag("log-format", "The format in which log messages are printed (default: text, options: text, json)").Default(defaultConfig.LogFormat).EnumVar(&cfg.LogFormat, "text", "json")
@@ -98,11 +444,57 @@ func (cfg *Config) ParseFlags(args []string) error {
 	// Flags related to the main control loop
 	app.Flag("interval", "The interval between two consecutive synchronizations in duration format (default: 1m)").Default(defaultConfig.Interval.String()).DurationVar(&cfg.Interval)
 	app.Flag("once", "When enabled, exits the synchronization loop after the first iteration (default: disabled)").Default(strconv.FormatBool(defaultConfig.Once)).BoolVar(&cfg.Once)
+	app.Flag("state-file", "Path of a file to persist the last synchronized secret versions to, so restarts do not rewrite unchanged secrets (optional)").Default(defaultConfig.StateFile).StringVar(&cfg.StateFile)
+
+	// Commands, sync is the default command
+	sync := app.Command("sync", "Synchronize secrets to sinks, or run a command with the secrets (default)").Default()
+	// Exec mode, e.g. `cloud-secrets --provider aws --secret-name db -- ./server`
+	sync.Arg("command", "Command to run with the fetched secrets exported as environment variables (optional)").StringsVar(&cfg.Command)
+
+	put := app.Command("put", "Create a secret or add a new version to it")
+	put.Flag("value", "The value of the secret").StringVar(&cfg.PutValue)
+	put.Flag("value-file", "Read the value of the secret from this file, - for stdin").StringVar(&cfg.PutValueFile)
+	put.Flag("tag", "Tag (label in GCP) of the secret in the form key=value, replacing all tags of an existing secret; specify multiple times for multiple tags").StringMapVar(&cfg.PutTags)
+
+	app.Command("delete", "Delete secrets")
+
+	// The provider flags are shared by source and destination unless overridden by the --to-* flags,
+	// e.g. `cloud-secrets --provider aws --aws-region eu-west-1 --gcp-project-id p --secret-name db copy --to google`
+	cp := app.Command("copy", "Copy secrets to another provider")
+	cp.Flag("to", "The destination provider (default: --provider, options: "+strings.Join(WriteProviders, ", ")+")").PlaceHolder("provider").EnumVar(&cfg.TargetProvider, WriteProviders...)
+	cfg.targetFlags(cp)
+	cp.Flag("conflict", "What to do with secrets which exist in the destination with a different value, overwrite adds a new version and replaces the tags (default: skip, options: skip, overwrite, new-version)").Default(defaultConfig.CopyConflict).EnumVar(&cfg.CopyConflict, "skip", "overwrite", "new-version")
+	cp.Flag("dry-run", "Only report what would be copied (default: disabled)").Default(strconv.FormatBool(defaultConfig.CopyDryRun)).BoolVar(&cfg.CopyDryRun)
+
+	// e.g. `cloud-secrets --provider aws --aws-assume-role <staging> --secret-name db diff --to-aws-assume-role <prod>`
+	diff := app.Command("diff", "Compare secrets with another provider or another account of the same provider")
+	diff.Flag("to", "The provider to compare with (default: --provider, options: "+strings.Join(Providers, ", ")+")").PlaceHolder("provider").EnumVar(&cfg.TargetProvider, Providers...)
+	cfg.targetFlags(diff)
+	diff.Flag("show-values", "Print differing values instead of their hashes (default: disabled)").Default(strconv.FormatBool(defaultConfig.DiffShowValues)).BoolVar(&cfg.DiffShowValues)
+
+	// Uses the --kubernetes-kubeconfig flag of the kubernetes sink
+	operator := app.Command("operator", "Run as Kubernetes operator synchronizing CloudSecret resources into Secrets")
+	operator.Flag("namespace", "Only watch CloudSecrets in this namespace (default: all namespaces)").Default(defaultConfig.OperatorNamespace).StringVar(&cfg.OperatorNamespace)
+	operator.Flag("leader-election", "Enable leader election, so only one of multiple replicas is active (default: disabled)").Default(strconv.FormatBool(defaultConfig.OperatorLeaderElection)).BoolVar(&cfg.OperatorLeaderElection)
+	operator.Flag("provider-namespace", "Namespace whose CloudSecrets may use --provider with the credentials of the operator, CloudSecrets in other namespaces have to reference a store; specify multiple times for multiple namespaces (optional)").StringsVar(&cfg.OperatorProviderNamespaces)
+
+	// The provider flags, except credentials, are passed on to the injected containers. They authenticate with the
+	// service account of their pod, so Azure requires managed-identity or workload-identity and Vault kubernetes auth.
+	wh := app.Command("webhook", "Run as mutating admission webhook injecting secrets into annotated pods")
+	wh.Flag("port", "The port of the webhook server (default: 9443)").Default(strconv.Itoa(defaultConfig.WebhookPort)).IntVar(&cfg.WebhookPort)
+	wh.Flag("cert-dir", "The directory holding tls.crt and tls.key of the webhook server (default: /tmp/k8s-webhook-server/serving-certs)").Default(defaultConfig.WebhookCertDir).StringVar(&cfg.WebhookCertDir)
+	wh.Flag("image", "The cloud-secrets image of the injected containers (required)").Default(defaultConfig.WebhookImage).StringVar(&cfg.WebhookImage)
+	wh.Flag("mount-path", "Where the volume holding the secrets is mounted in the containers of pods (default: /var/run/secrets/cloud-secrets)").Default(defaultConfig.WebhookMountPath).StringVar(&cfg.WebhookMountPath)
+
+	// Secrets come from the provider configured by flags, or from SecretStores referenced by SecretProviderClasses
+	csi := app.Command("csi-provider", "Run as provider plugin of the Secrets Store CSI Driver, mounting secrets of SecretStores and ClusterSecretStores into pods")
+	csi.Flag("endpoint", "The unix socket the driver connects to (default: /var/run/secrets-store-csi-providers/cloud-secrets.sock)").Default(defaultConfig.CSIEndpoint).StringVar(&cfg.CSIEndpoint)
 
-	_, err := app.Parse(args)
+	mode, err := app.Parse(args)
 	if err != nil {
 		return err
 	}
+	cfg.Mode = mode
 
 	return nil
 }
@@ -0,0 +1,45 @@
+package cloudsecrets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigStringRedactsCredentials(t *testing.T) {
+	cfg := NewConfig()
+	if err := cfg.ParseFlags([]string{
+		"--provider", "vault",
+		"--vault-token", "s.token",
+		"--vault-secret-id", "approle-secret",
+		"--azure-client-secret", "client-secret",
+		"--azure-client-certificate-password", "certificate-password",
+		"--secret-name", "db",
+		"put", "--value", "put-value",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := cfg.String()
+	for _, secret := range []string{"s.token", "approle-secret", "client-secret", "certificate-password", "put-value"} {
+		if strings.Contains(s, secret) {
+			t.Errorf("config contains %q: %s", secret, s)
+		}
+	}
+	if !strings.Contains(s, "VaultToken:*****") {
+		t.Errorf("config doesn't redact the vault token: %s", s)
+	}
+	if cfg.VaultToken != "s.token" {
+		t.Errorf("String modified the config: %q", cfg.VaultToken)
+	}
+}
+
+func TestConfigStringKeepsEmptyCredentials(t *testing.T) {
+	cfg := NewConfig()
+	if err := cfg.ParseFlags([]string{"--provider", "vault", "--secret-name", "db"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := cfg.String(); strings.Contains(s, "*****") {
+		t.Errorf("config redacts unset credentials: %s", s)
+	}
+}
@@ -0,0 +1,146 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionReady is the condition reporting whether the target Secret is in sync
+const ConditionReady = "Ready"
+
+// Reasons of the Ready condition
+const (
+	ReasonSynced     = "Synced"
+	ReasonSyncFailed = "SyncFailed"
+)
+
+// CloudSecretSpec defines the desired state of a CloudSecret
+type CloudSecretSpec struct {
+	// ProviderRef selects the provider the secrets are fetched from, the default provider of the controller if empty.
+	// The provider of the controller can only be used in the namespaces it allows, e.g. its own.
+	// +optional
+	ProviderRef ProviderRef `json:"providerRef,omitempty"`
+
+	// Data selects the remote secrets, or keys of them, which are written into the target Secret.
+	// The keys written by different entries must not overlap.
+	// +kubebuilder:validation:MinItems=1
+	Data []RemoteSecret `json:"data"`
+
+	// Target describes the Secret the data is written to
+	// +optional
+	Target TargetSecret `json:"target,omitempty"`
+
+	// RefreshInterval is the interval between two synchronizations, the interval of the controller if unset
+	// +optional
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
+}
+
+// ProviderRef references a provider configured in the controller, or a SecretStore or ClusterSecretStore
+// +kubebuilder:validation:XValidation:rule="!has(self.kind) || has(self.name)",message="name is required to reference a store"
+type ProviderRef struct {
+	// Kind of the referenced store, the provider is configured in the controller if empty
+	// +kubebuilder:validation:Enum=SecretStore;ClusterSecretStore
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the store, or of the provider configured in the controller, e.g. aws or google
+	// +optional
+	Name string `json:"name,omitempty"`
+}
+
+// RemoteSecret selects a remote secret, or a single key of it
+type RemoteSecret struct {
+	// Name of the secret in the provider
+	Name string `json:"name"`
+
+	// Version selects a provider specific version of the secret, e.g. a GCP version number, an AWS version ID or an AWS staging label
+	// (AWSCURRENT, AWSPENDING, AWSPREVIOUS, or a custom label prefixed with stage:)
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Key selects a single key of a secret holding a JSON object
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// SecretKey is the key in the target Secret, it defaults to Key.
+	// Without Key and SecretKey, all keys of a JSON object secret are written,
+	// other secrets are written to a key named after the secret.
+	// Keys defaulted from names are mapped to valid keys, e.g. db/password becomes db_password.
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// TargetSecret describes the Secret created by the controller
+type TargetSecret struct {
+	// Name of the Secret, defaults to the name of the CloudSecret.
+	// Existing Secrets created by others are never taken over, the Secret of a previous name is deleted.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Template of the Secret
+	// +optional
+	Template SecretTemplate `json:"template,omitempty"`
+}
+
+// SecretTemplate holds the type and metadata of the target Secret
+type SecretTemplate struct {
+	// Type of the Secret (default: Opaque), it can't be changed once the Secret exists
+	// +optional
+	Type corev1.SecretType `json:"type,omitempty"`
+
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// CloudSecretStatus defines the observed state of a CloudSecret
+type CloudSecretStatus struct {
+	// ObservedGeneration is the generation of the spec the status refers to
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions hold the Ready condition, whose message is the error of a failed synchronization
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// LastSyncTime is the time of the last successful synchronization
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// SyncedVersion lists the versions of the remote secrets written by the last successful synchronization
+	// +optional
+	SyncedVersion string `json:"syncedVersion,omitempty"`
+}
+
+// CloudSecret synchronizes secrets of a cloud provider into a Kubernetes Secret
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.status.syncedVersion`
+// +kubebuilder:printcolumn:name="Last Sync",type=date,JSONPath=`.status.lastSyncTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type CloudSecret struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CloudSecretSpec   `json:"spec,omitempty"`
+	Status CloudSecretStatus `json:"status,omitempty"`
+}
+
+// CloudSecretList contains a list of CloudSecrets
+// +kubebuilder:object:root=true
+type CloudSecretList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CloudSecret `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CloudSecret{}, &CloudSecretList{})
+}
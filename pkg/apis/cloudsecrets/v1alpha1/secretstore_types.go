@@ -0,0 +1,260 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kinds of the stores referenced by the providerRef of CloudSecrets
+const (
+	SecretStoreKind        = "SecretStore"
+	ClusterSecretStoreKind = "ClusterSecretStore"
+)
+
+// SecretStoreSpec describes a provider account and its credentials
+type SecretStoreSpec struct {
+	// Provider configures the provider of the store
+	Provider StoreProvider `json:"provider"`
+}
+
+// StoreProvider configures exactly one provider
+// +kubebuilder:validation:MinProperties=1
+// +kubebuilder:validation:MaxProperties=1
+type StoreProvider struct {
+	// +optional
+	AWS *AWSStoreProvider `json:"aws,omitempty"`
+
+	// +optional
+	Azure *AzureStoreProvider `json:"azure,omitempty"`
+
+	// +optional
+	Google *GoogleStoreProvider `json:"google,omitempty"`
+
+	// +optional
+	Vault *VaultStoreProvider `json:"vault,omitempty"`
+}
+
+// AWSStoreProvider configures AWS Secrets Manager or SSM Parameter Store.
+// Auth is required in SecretStores, ClusterSecretStores without auth use the credentials of the controller.
+type AWSStoreProvider struct {
+	// Service is SecretsManager (default) or ParameterStore
+	// +kubebuilder:validation:Enum=SecretsManager;ParameterStore
+	// +optional
+	Service string `json:"service,omitempty"`
+
+	Region string `json:"region"`
+
+	// Role is the ARN of a role to assume, it is required with a service account
+	// +optional
+	Role string `json:"role,omitempty"`
+
+	// VersionStage is the default staging label of Secrets Manager secrets (default: AWSCURRENT)
+	// +optional
+	VersionStage string `json:"versionStage,omitempty"`
+
+	// +optional
+	Auth AWSAuth `json:"auth,omitempty"`
+}
+
+// AWSAuth selects the credentials of AWS, either an access key or a service account
+// +kubebuilder:validation:MaxProperties=1
+type AWSAuth struct {
+	// SecretRef references an access key
+	// +optional
+	SecretRef *AWSSecretRef `json:"secretRef,omitempty"`
+
+	// ServiceAccountRef references a service account whose token is exchanged for credentials of the role
+	// +optional
+	ServiceAccountRef *ServiceAccountSelector `json:"serviceAccountRef,omitempty"`
+}
+
+// AWSSecretRef references the keys of an AWS access key
+type AWSSecretRef struct {
+	AccessKeyID     SecretKeySelector `json:"accessKeyIDSecretRef"`
+	SecretAccessKey SecretKeySelector `json:"secretAccessKeySecretRef"`
+}
+
+// AzureStoreProvider configures Azure Key Vault.
+// Auth is required in SecretStores, ClusterSecretStores without auth use the managed identity of the controller,
+// ClientID selects a user-assigned identity.
+type AzureStoreProvider struct {
+	// KeyVaults by name, the URL is derived from the environment
+	// +optional
+	KeyVaults []string `json:"keyVaults,omitempty"`
+
+	// VaultURLs of additional vaults
+	// +optional
+	VaultURLs []string `json:"vaultURLs,omitempty"`
+
+	// Environment is the name of the Azure cloud (default: AzurePublicCloud)
+	// +optional
+	Environment string `json:"environment,omitempty"`
+
+	// +optional
+	TenantID string `json:"tenantID,omitempty"`
+
+	// +optional
+	ClientID string `json:"clientID,omitempty"`
+
+	// +optional
+	Auth AzureAuth `json:"auth,omitempty"`
+}
+
+// AzureAuth selects the credentials of Azure, either a client secret or a service account (workload identity)
+// +kubebuilder:validation:MaxProperties=1
+type AzureAuth struct {
+	// ClientSecretRef references the secret of the client
+	// +optional
+	ClientSecretRef *SecretKeySelector `json:"clientSecretRef,omitempty"`
+
+	// ServiceAccountRef references a service account federated with the client
+	// +optional
+	ServiceAccountRef *ServiceAccountSelector `json:"serviceAccountRef,omitempty"`
+}
+
+// GoogleStoreProvider configures Google Secret Manager.
+// Auth is required in SecretStores, ClusterSecretStores without auth use the application default credentials of the controller.
+type GoogleStoreProvider struct {
+	ProjectID string `json:"projectID"`
+
+	// ImpersonateServiceAccount is a service account impersonated with the credentials
+	// +optional
+	ImpersonateServiceAccount string `json:"impersonateServiceAccount,omitempty"`
+
+	// +optional
+	Auth GoogleAuth `json:"auth,omitempty"`
+}
+
+// GoogleAuth selects the credentials of Google
+type GoogleAuth struct {
+	// SecretRef references a service account key or other credentials JSON
+	// +optional
+	SecretRef *SecretKeySelector `json:"secretRef,omitempty"`
+}
+
+// VaultStoreProvider configures the KV secrets engine of HashiCorp Vault
+type VaultStoreProvider struct {
+	// Server is the address of Vault, e.g. https://vault.example.com:8200
+	Server string `json:"server"`
+
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// MountPath of the KV secrets engine (default: secret)
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// KVVersion of the secrets engine (default: 2)
+	// +kubebuilder:validation:Enum=1;2
+	// +optional
+	KVVersion int `json:"kvVersion,omitempty"`
+
+	Auth VaultAuth `json:"auth"`
+}
+
+// VaultAuth selects exactly one auth method of Vault
+// +kubebuilder:validation:MinProperties=1
+// +kubebuilder:validation:MaxProperties=1
+type VaultAuth struct {
+	// TokenSecretRef references a Vault token
+	// +optional
+	TokenSecretRef *SecretKeySelector `json:"tokenSecretRef,omitempty"`
+
+	// +optional
+	AppRole *VaultAppRoleAuth `json:"appRole,omitempty"`
+
+	// +optional
+	Kubernetes *VaultKubernetesAuth `json:"kubernetes,omitempty"`
+}
+
+// VaultAppRoleAuth logs in using the approle auth method
+type VaultAppRoleAuth struct {
+	// MountPath of the auth method (default: approle)
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	RoleID string `json:"roleID"`
+
+	SecretRef SecretKeySelector `json:"secretRef"`
+}
+
+// VaultKubernetesAuth logs in using the kubernetes auth method
+type VaultKubernetesAuth struct {
+	// MountPath of the auth method (default: kubernetes)
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	Role string `json:"role"`
+
+	// ServiceAccountRef references the service account logging in, it is required in SecretStores.
+	// ClusterSecretStores without it log in with the service account of the controller.
+	// +optional
+	ServiceAccountRef *ServiceAccountSelector `json:"serviceAccountRef,omitempty"`
+}
+
+// SecretKeySelector references a key of a Kubernetes Secret
+type SecretKeySelector struct {
+	Name string `json:"name"`
+
+	// Namespace of the Secret, only allowed (and required) in ClusterSecretStores
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	Key string `json:"key"`
+}
+
+// ServiceAccountSelector references a Kubernetes service account, the controller requests tokens for it
+type ServiceAccountSelector struct {
+	Name string `json:"name"`
+
+	// Namespace of the service account, only allowed (and required) in ClusterSecretStores
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Audiences of the tokens, defaults to the audience expected by the provider:
+	// sts.amazonaws.com for AWS, api://AzureADTokenExchange for Azure and the API server for Vault
+	// +optional
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+// SecretStore describes a provider account usable by the CloudSecrets of its namespace.
+// Credentials are read from Secrets and service accounts of the same namespace.
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type SecretStore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SecretStoreSpec `json:"spec,omitempty"`
+}
+
+// SecretStoreList contains a list of SecretStores
+// +kubebuilder:object:root=true
+type SecretStoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SecretStore `json:"items"`
+}
+
+// ClusterSecretStore describes a provider account usable by CloudSecrets of all namespaces.
+// Credentials are read from Secrets and service accounts of the namespaces given in the references.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ClusterSecretStore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec SecretStoreSpec `json:"spec,omitempty"`
+}
+
+// ClusterSecretStoreList contains a list of ClusterSecretStores
+// +kubebuilder:object:root=true
+type ClusterSecretStoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterSecretStore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SecretStore{}, &SecretStoreList{}, &ClusterSecretStore{}, &ClusterSecretStoreList{})
+}
@@ -3,20 +3,156 @@ package validation
 import (
 	"errors"
 	"fmt"
+	"github.com/kvendingoldo/cloud-secrets/hook"
 	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/sink"
+	"strings"
 )
 
 func ValidateConfig(cfg *cloudsecrets.Config) error {
 	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
 		return fmt.Errorf("unsupported log format: %s", cfg.LogFormat)
 	}
+	// The CSI provider only uses the providers of stores
+	if cfg.Mode == "csi-provider" {
+		if cfg.CSIEndpoint == "" {
+			return errors.New("no CSI endpoint specified")
+		}
+		return nil
+	}
+	// Without a provider, the operator only uses the providers of stores
+	if cfg.Mode == "operator" && cfg.Provider == "" {
+		if len(cfg.OperatorProviderNamespaces) > 0 {
+			return errors.New("provider namespaces require a provider")
+		}
+		return nil
+	}
 	if cfg.Provider == "" {
 		return errors.New("no provider specified")
 	}
 
-	if cfg.SecretName == "" {
-		return errors.New("no secret name specified")
+	if err := validateProvider(cfg); err != nil {
+		return err
+	}
+	if cfg.Mode == "copy" || cfg.Mode == "diff" {
+		if err := validateProvider(cfg.Target()); err != nil {
+			return err
+		}
+	}
+
+	switch cfg.Mode {
+	case "put", "delete":
+		if !isWriteProvider(cfg.Provider) {
+			return fmt.Errorf("provider %s does not support writing secrets", cfg.Provider)
+		}
+	case "copy":
+		if target := cfg.Target().Provider; !isWriteProvider(target) {
+			return fmt.Errorf("provider %s does not support writing secrets", target)
+		}
+	}
+
+	switch cfg.Mode {
+	case "put":
+		if len(cfg.SecretNames) != 1 {
+			return errors.New("put requires exactly one secret name")
+		}
+		if (cfg.PutValue == "") == (cfg.PutValueFile == "") {
+			return errors.New("put requires either a value or a value file")
+		}
+	case "delete":
+		if len(cfg.SecretNames) == 0 {
+			return errors.New("no secret name specified")
+		}
+	case "operator":
+		// The secrets are specified by CloudSecret resources
+	case "webhook":
+		// The secrets are specified by the annotations of pods
+		if cfg.WebhookImage == "" {
+			return errors.New("no webhook image specified")
+		}
+		if !strings.HasPrefix(cfg.WebhookMountPath, "/") {
+			return fmt.Errorf("webhook mount path must be absolute: %s", cfg.WebhookMountPath)
+		}
+		// The injected containers get no credentials, they have to authenticate with the service account of the pod
+		switch {
+		case cfg.Provider == "azure" && cfg.AzureAuthMethod != "managed-identity" && cfg.AzureAuthMethod != "workload-identity":
+			return fmt.Errorf("webhook requires azure auth method managed-identity or workload-identity, got %s", cfg.AzureAuthMethod)
+		case cfg.Provider == "vault" && cfg.VaultAuthMethod != "kubernetes":
+			return fmt.Errorf("webhook requires vault auth method kubernetes, got %s", cfg.VaultAuthMethod)
+		}
+	default:
+		if len(cfg.SecretNames) == 0 && cfg.SecretsFile == "" && len(cfg.SelectorTags) == 0 && cfg.SelectorNamePrefix == "" {
+			return errors.New("no secret name specified")
+		}
+	}
+	if cfg.Concurrency < 1 {
+		return fmt.Errorf("invalid concurrency: %d", cfg.Concurrency)
+	}
+
+	for _, s := range cfg.Sinks {
+		switch s {
+		case "dotenv":
+			if cfg.DotenvPath == "" {
+				return errors.New("no dotenv path specified")
+			}
+			if _, err := sink.ParseFileMode(cfg.DotenvFileMode); err != nil {
+				return err
+			}
+		case "template":
+			if len(cfg.Templates) == 0 {
+				return errors.New("no template specified")
+			}
+			if _, err := sink.ParseFileMode(cfg.TemplateFileMode); err != nil {
+				return err
+			}
+		case "kubernetes":
+			if cfg.KubernetesSecretKey == "" {
+				return errors.New("no kubernetes secret key specified")
+			}
+		}
+	}
+
+	if cfg.HookSignalPidFile != "" {
+		if _, err := hook.ParseSignal(cfg.HookSignal); err != nil {
+			return err
+		}
+	}
+	if cfg.HookRetries < 0 {
+		return fmt.Errorf("invalid hook retries: %d", cfg.HookRetries)
 	}
 
 	return nil
 }
+
+// validateProvider validates the options of the configured provider
+func validateProvider(cfg *cloudsecrets.Config) error {
+	if cfg.Provider == "azure" && len(cfg.AzureKeyVaults) == 0 && len(cfg.AzureVaultURLs) == 0 {
+		return errors.New("no azure key vault specified")
+	}
+	if cfg.Provider == "vault" {
+		if cfg.VaultKVVersion != 1 && cfg.VaultKVVersion != 2 {
+			return fmt.Errorf("unsupported vault KV version: %d", cfg.VaultKVVersion)
+		}
+		if cfg.VaultAuthMethod == "approle" && (cfg.VaultRoleID == "" || cfg.VaultSecretID == "") {
+			return errors.New("no vault role ID or secret ID specified")
+		}
+		if cfg.VaultAuthMethod == "kubernetes" && cfg.VaultRole == "" {
+			return errors.New("no vault role specified")
+		}
+	}
+	if cfg.Provider == "file" && cfg.FilePath == "" {
+		return errors.New("no file path specified")
+	}
+
+	return nil
+}
+
+// isWriteProvider reports whether the provider supports writing secrets
+func isWriteProvider(name string) bool {
+	for _, p := range cloudsecrets.WriteProviders {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
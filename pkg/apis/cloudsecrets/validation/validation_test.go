@@ -0,0 +1,54 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+)
+
+func TestValidateWebhookAuthMethod(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name: "aws",
+			args: []string{"--provider", "aws"},
+		},
+		{
+			name: "azure workload identity",
+			args: []string{"--provider", "azure", "--azure-key-vault", "kv", "--azure-auth-method", "workload-identity"},
+		},
+		{
+			name:    "azure client secret",
+			args:    []string{"--provider", "azure", "--azure-key-vault", "kv", "--azure-auth-method", "client-secret", "--azure-tenant-id", "t", "--azure-client-id", "c", "--azure-client-secret", "s"},
+			wantErr: "webhook requires azure auth method",
+		},
+		{
+			name: "vault kubernetes",
+			args: []string{"--provider", "vault", "--vault-address", "https://vault:8200", "--vault-auth-method", "kubernetes", "--vault-role", "app"},
+		},
+		{
+			name:    "vault token",
+			args:    []string{"--provider", "vault", "--vault-address", "https://vault:8200", "--vault-token", "s.token"},
+			wantErr: "webhook requires vault auth method kubernetes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cloudsecrets.NewConfig()
+			if err := cfg.ParseFlags(append(tt.args, "webhook", "--image", "cloud-secrets:test")); err != nil {
+				t.Fatal(err)
+			}
+			err := ValidateConfig(cfg)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
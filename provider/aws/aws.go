@@ -1,14 +1,17 @@
 package aws
 
 import (
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/kvendingoldo/cloud-secrets/provider"
 	"github.com/linki/instrumented_http"
 	log "github.com/sirupsen/logrus"
@@ -97,17 +100,48 @@ type SecretsManagerAPI interface {
 
 type AWSProvider struct {
 	provider.BaseProvider
-	client SecretsManagerAPI
+	client       SecretsManagerAPI
+	versionStage string
+	forceDelete  bool
 }
 
 type AWSConfig struct {
 	Region     string
 	APIRetries int
 	AssumeRole string
+	// VersionStage is the default staging label of secrets (default: AWSCURRENT)
+	VersionStage string
+	// ForceDelete deletes secrets without a recovery window
+	ForceDelete bool
+
+	// AccessKeyID and SecretAccessKey are static credentials, the default credential chain is used otherwise
+	AccessKeyID     string
+	SecretAccessKey string
+	// WebIdentityToken returns a token, e.g. of a Kubernetes service account, which is exchanged for credentials of AssumeRole
+	WebIdentityToken func() (string, error)
 }
 
 func NewAWSProvider(awsConfig AWSConfig) (*AWSProvider, error) {
+	session, err := newSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &AWSProvider{
+		client:       secretsmanager.New(session),
+		versionStage: awsConfig.VersionStage,
+		forceDelete:  awsConfig.ForceDelete,
+	}
+
+	return provider, nil
+}
+
+// newSession creates an AWS session with the region, retries and assumed role of awsConfig
+func newSession(awsConfig AWSConfig) (*session.Session, error) {
 	config := aws.NewConfig().WithMaxRetries(awsConfig.APIRetries).WithRegion(awsConfig.Region)
+	if awsConfig.AccessKeyID != "" {
+		config.WithCredentials(credentials.NewStaticCredentials(awsConfig.AccessKeyID, awsConfig.SecretAccessKey, ""))
+	}
 
 	config.WithHTTPClient(
 		instrumented_http.NewClient(config.HTTPClient, &instrumented_http.Callbacks{
@@ -128,69 +162,164 @@ func NewAWSProvider(awsConfig AWSConfig) (*AWSProvider, error) {
 
 	if awsConfig.AssumeRole != "" {
 		log.Infof("Assuming role: %s", awsConfig.AssumeRole)
-		session.Config.WithCredentials(stscreds.NewCredentials(session, awsConfig.AssumeRole))
-	}
-	provider := &AWSProvider{
-		client: secretsmanager.New(session),
+		if awsConfig.WebIdentityToken != nil {
+			session.Config.WithCredentials(credentials.NewCredentials(stscreds.NewWebIdentityRoleProviderWithOptions(
+				sts.New(session), awsConfig.AssumeRole, "cloud-secrets", tokenFetcher(awsConfig.WebIdentityToken),
+			)))
+		} else {
+			session.Config.WithCredentials(stscreds.NewCredentials(session, awsConfig.AssumeRole))
+		}
 	}
 
-	return provider, nil
+	return session, nil
 }
 
-func (p *AWSProvider) GetSecret(name string) {
+// tokenFetcher adapts a token function to stscreds.TokenFetcher
+type tokenFetcher func() (string, error)
+
+func (f tokenFetcher) FetchToken(credentials.Context) ([]byte, error) {
+	token, err := f()
+	return []byte(token), err
+}
 
+func (p *AWSProvider) GetSecret(ctx context.Context, name string) (*provider.Secret, error) {
 	input := &secretsmanager.GetSecretValueInput{
-		SecretId:     aws.String(name),
-		VersionStage: aws.String("AWSCURRENT"), // VersionStage defaults to AWSCURRENT if unspecified
+		SecretId: aws.String(name),
+	}
+	// VersionStage defaults to AWSCURRENT if unspecified
+	if p.versionStage != "" {
+		input.VersionStage = aws.String(p.versionStage)
 	}
+	return p.getSecretValue(ctx, name, input)
+}
 
-	result, err := p.client.GetSecretValue(input)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case secretsmanager.ErrCodeDecryptionFailure:
-				// Secrets Manager can't decrypt the protected secret text using the provided KMS key.
-				fmt.Println(secretsmanager.ErrCodeDecryptionFailure, aerr.Error())
-
-			case secretsmanager.ErrCodeInternalServiceError:
-				// An error occurred on the server side.
-				fmt.Println(secretsmanager.ErrCodeInternalServiceError, aerr.Error())
-
-			case secretsmanager.ErrCodeInvalidParameterException:
-				// You provided an invalid value for a parameter.
-				fmt.Println(secretsmanager.ErrCodeInvalidParameterException, aerr.Error())
-
-			case secretsmanager.ErrCodeInvalidRequestException:
-				// You provided a parameter value that is not valid for the current state of the resource.
-				fmt.Println(secretsmanager.ErrCodeInvalidRequestException, aerr.Error())
-
-			case secretsmanager.ErrCodeResourceNotFoundException:
-				// We can't find the resource that you asked for.
-				fmt.Println(secretsmanager.ErrCodeResourceNotFoundException, aerr.Error())
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			fmt.Println(err.Error())
+// VersionStagePrefix marks versions which are custom staging labels rather than version IDs, e.g. stage:blue
+const VersionStagePrefix = "stage:"
+
+// reservedVersionStages are the staging labels of Secrets Manager,
+// which are selected without VersionStagePrefix like with --aws-version-stage
+var reservedVersionStages = map[string]bool{
+	"AWSCURRENT":  true,
+	"AWSPENDING":  true,
+	"AWSPREVIOUS": true,
+}
+
+// GetSecretVersion fetches a version of a secret, which is either a version ID, one of the staging labels
+// AWSCURRENT, AWSPENDING and AWSPREVIOUS, or a custom staging label prefixed with VersionStagePrefix.
+func (p *AWSProvider) GetSecretVersion(ctx context.Context, name string, version string) (*provider.Secret, error) {
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	}
+	if stage, ok := strings.CutPrefix(version, VersionStagePrefix); ok {
+		if stage == "" {
+			return nil, fmt.Errorf("empty staging label of secret %s", name)
 		}
-		return
+		input.VersionStage = aws.String(stage)
+	} else if reservedVersionStages[version] {
+		input.VersionStage = aws.String(version)
+	} else if version != "" {
+		input.VersionId = aws.String(version)
+	}
+	return p.getSecretValue(ctx, name, input)
+}
+
+// getSecretValue fetches the version of a secret selected by input
+func (p *AWSProvider) getSecretValue(ctx context.Context, name string, input *secretsmanager.GetSecretValueInput) (*provider.Secret, error) {
+	result, err := p.client.GetSecretValueWithContext(ctx, input)
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("failed to get secret %s: %w", name, err))
 	}
 
-	// Decrypts secret using the associated KMS CMK.
 	// Depending on whether the secret is a string or binary, one of these fields will be populated.
-	var secretString, decodedBinarySecret string
+	// SecretBinary is base64 decoded by the SDK already.
+	var value []byte
 	if result.SecretString != nil {
-		secretString = *result.SecretString
+		value = []byte(*result.SecretString)
 	} else {
-		decodedBinarySecretBytes := make([]byte, base64.StdEncoding.DecodedLen(len(result.SecretBinary)))
-		len, err := base64.StdEncoding.Decode(decodedBinarySecretBytes, result.SecretBinary)
-		if err != nil {
-			fmt.Println("Base64 Decode Error:", err)
-			return
+		value = result.SecretBinary
+	}
+
+	metadata := map[string]string{
+		"arn": aws.StringValue(result.ARN),
+	}
+	if len(result.VersionStages) > 0 {
+		metadata["versionStages"] = strings.Join(aws.StringValueSlice(result.VersionStages), ",")
+	}
+
+	return &provider.Secret{
+		Name:      name,
+		Value:     value,
+		Version:   aws.StringValue(result.VersionId),
+		CreatedAt: aws.TimeValue(result.CreatedDate),
+		Metadata:  metadata,
+	}, nil
+}
+
+// wrapError attaches the AWS error code to err
+func wrapError(err error) error {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return &provider.Error{Code: aerr.Code(), Err: err}
+	}
+	return err
+}
+
+func (p *AWSProvider) ListSecrets(ctx context.Context, selector provider.Selector) ([]string, error) {
+	// The API filters are coarser than the selector (e.g. tag keys and values are matched independently),
+	// so they only narrow down the result, which is matched exactly afterwards.
+	var filters []*secretsmanager.Filter
+	if selector.NamePrefix != "" {
+		filters = append(filters, &secretsmanager.Filter{
+			Key:    aws.String(secretsmanager.FilterNameStringTypeName),
+			Values: aws.StringSlice([]string{selector.NamePrefix}),
+		})
+	}
+	for k := range selector.Tags {
+		filters = append(filters, &secretsmanager.Filter{
+			Key:    aws.String(secretsmanager.FilterNameStringTypeTagKey),
+			Values: aws.StringSlice([]string{k}),
+		})
+	}
+
+	input := &secretsmanager.ListSecretsInput{}
+	if len(filters) > 0 {
+		input.Filters = filters
+	}
+
+	var names []string
+	err := p.client.ListSecretsPagesWithContext(ctx, input, func(page *secretsmanager.ListSecretsOutput, lastPage bool) bool {
+		for _, entry := range page.SecretList {
+			tags := make(map[string]string, len(entry.Tags))
+			for _, tag := range entry.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+
+			name := aws.StringValue(entry.Name)
+			if selector.Matches(name, tags) {
+				names = append(names, name)
+			}
 		}
-		decodedBinarySecret = string(decodedBinarySecretBytes[:len])
+		return true
+	})
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("failed to list secrets: %w", err))
+	}
+
+	return names, nil
+}
+
+func (p *AWSProvider) GetSecretTags(ctx context.Context, name string) (map[string]string, error) {
+	result, err := p.client.DescribeSecretWithContext(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("failed to describe secret %s: %w", name, err))
+	}
+
+	tags := make(map[string]string, len(result.Tags))
+	for _, tag := range result.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
 	}
 
-	fmt.Println(secretString)
-	fmt.Println(decodedBinarySecret)
+	return tags, nil
 }
@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+// fakeSecretsManager serves the versions of a single secret, methods not overridden panic
+type fakeSecretsManager struct {
+	SecretsManagerAPI
+	// versions by version ID
+	versions map[string]*secretsmanager.GetSecretValueOutput
+	// inputs of GetSecretValue
+	inputs []*secretsmanager.GetSecretValueInput
+}
+
+func (f *fakeSecretsManager) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	f.inputs = append(f.inputs, input)
+	if input.VersionId != nil && input.VersionStage != nil {
+		return nil, awserr.New(secretsmanager.ErrCodeInvalidParameterException, "both version ID and stage specified", nil)
+	}
+
+	stage := aws.StringValue(input.VersionStage)
+	if input.VersionId == nil && stage == "" {
+		stage = "AWSCURRENT"
+	}
+	for id, version := range f.versions {
+		if id == aws.StringValue(input.VersionId) {
+			return version, nil
+		}
+		for _, s := range aws.StringValueSlice(version.VersionStages) {
+			if s == stage {
+				return version, nil
+			}
+		}
+	}
+	return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "version not found", nil)
+}
+
+func newTestAWSProvider(versionStage string) (*AWSProvider, *fakeSecretsManager) {
+	version := func(id, value string, stages ...string) *secretsmanager.GetSecretValueOutput {
+		return &secretsmanager.GetSecretValueOutput{
+			ARN:           aws.String("arn:aws:secretsmanager:eu-west-1:123:secret:db"),
+			Name:          aws.String("db"),
+			SecretString:  aws.String(value),
+			VersionId:     aws.String(id),
+			VersionStages: aws.StringSlice(stages),
+		}
+	}
+	client := &fakeSecretsManager{versions: map[string]*secretsmanager.GetSecretValueOutput{
+		"3f1c2a3e-0000-4000-8000-000000000003": version("3f1c2a3e-0000-4000-8000-000000000003", "pending", "AWSPENDING"),
+		"3f1c2a3e-0000-4000-8000-000000000002": version("3f1c2a3e-0000-4000-8000-000000000002", "current", "AWSCURRENT", "blue"),
+		"3f1c2a3e-0000-4000-8000-000000000001": version("3f1c2a3e-0000-4000-8000-000000000001", "previous", "AWSPREVIOUS"),
+	}}
+	return &AWSProvider{client: client, versionStage: versionStage}, client
+}
+
+func TestGetSecretVersionStage(t *testing.T) {
+	p, _ := newTestAWSProvider("AWSPENDING")
+
+	secret, err := p.GetSecret(context.Background(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Value) != "pending" {
+		t.Errorf("value = %q, want the AWSPENDING version", secret.Value)
+	}
+	if secret.Metadata["versionStages"] != "AWSPENDING" {
+		t.Errorf("metadata = %v", secret.Metadata)
+	}
+}
+
+func TestGetSecretVersion(t *testing.T) {
+	tests := []struct {
+		version   string
+		wantID    string
+		wantStage string
+		value     string
+	}{
+		{version: "3f1c2a3e-0000-4000-8000-000000000001", wantID: "3f1c2a3e-0000-4000-8000-000000000001", value: "previous"},
+		{version: "AWSCURRENT", wantStage: "AWSCURRENT", value: "current"},
+		{version: "AWSPENDING", wantStage: "AWSPENDING", value: "pending"},
+		{version: "AWSPREVIOUS", wantStage: "AWSPREVIOUS", value: "previous"},
+		{version: "stage:AWSPENDING", wantStage: "AWSPENDING", value: "pending"},
+		{version: "stage:blue", wantStage: "blue", value: "current"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			p, client := newTestAWSProvider("")
+
+			secret, err := p.GetSecretVersion(context.Background(), "db", tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(secret.Value) != tt.value {
+				t.Errorf("value = %q, want %q", secret.Value, tt.value)
+			}
+
+			input := client.inputs[0]
+			if aws.StringValue(input.VersionId) != tt.wantID || aws.StringValue(input.VersionStage) != tt.wantStage {
+				t.Errorf("version ID = %q, stage = %q, want %q, %q",
+					aws.StringValue(input.VersionId), aws.StringValue(input.VersionStage), tt.wantID, tt.wantStage)
+			}
+		})
+	}
+}
+
+func TestGetSecretVersionErrors(t *testing.T) {
+	p, _ := newTestAWSProvider("")
+
+	if _, err := p.GetSecretVersion(context.Background(), "db", "stage:"); err == nil {
+		t.Error("expected error for an empty staging label")
+	}
+	_, err := p.GetSecretVersion(context.Background(), "db", "stage:green")
+	if !provider.IsNotFound(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
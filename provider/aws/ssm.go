@@ -0,0 +1,118 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+// SSMAPI is the subset of the SSM client used by SSMProvider
+type SSMAPI interface {
+	GetParameter(*ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+	GetParameterWithContext(aws.Context, *ssm.GetParameterInput, ...request.Option) (*ssm.GetParameterOutput, error)
+
+	GetParametersByPath(*ssm.GetParametersByPathInput) (*ssm.GetParametersByPathOutput, error)
+	GetParametersByPathWithContext(aws.Context, *ssm.GetParametersByPathInput, ...request.Option) (*ssm.GetParametersByPathOutput, error)
+
+	GetParametersByPathPages(*ssm.GetParametersByPathInput, func(*ssm.GetParametersByPathOutput, bool) bool) error
+	GetParametersByPathPagesWithContext(aws.Context, *ssm.GetParametersByPathInput, func(*ssm.GetParametersByPathOutput, bool) bool, ...request.Option) error
+}
+
+// SSMProvider reads secrets from SSM Parameter Store.
+// Names ending with a slash are treated as paths, all parameters below such a path
+// are fetched recursively and returned as a single JSON secret keyed by their relative names,
+// e.g. /app/prod/db/password below /app/prod/ becomes the key "db/password".
+type SSMProvider struct {
+	provider.BaseProvider
+	client SSMAPI
+}
+
+func NewSSMProvider(awsConfig AWSConfig) (*SSMProvider, error) {
+	session, err := newSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &SSMProvider{
+		client: ssm.New(session),
+	}
+
+	return provider, nil
+}
+
+func (p *SSMProvider) GetSecret(ctx context.Context, name string) (*provider.Secret, error) {
+	if strings.HasSuffix(name, "/") {
+		return p.getSecretsByPath(ctx, name)
+	}
+
+	input := &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	}
+
+	result, err := p.client.GetParameterWithContext(ctx, input)
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("failed to get parameter %s: %w", name, err))
+	}
+
+	return &provider.Secret{
+		Name:      name,
+		Value:     []byte(aws.StringValue(result.Parameter.Value)),
+		Version:   strconv.FormatInt(aws.Int64Value(result.Parameter.Version), 10),
+		CreatedAt: aws.TimeValue(result.Parameter.LastModifiedDate),
+		Metadata: map[string]string{
+			"arn":  aws.StringValue(result.Parameter.ARN),
+			"type": aws.StringValue(result.Parameter.Type),
+		},
+	}, nil
+}
+
+// getSecretsByPath fetches all parameters below path.
+// The secret has no version, as there is no single version of a parameter hierarchy.
+func (p *SSMProvider) getSecretsByPath(ctx context.Context, path string) (*provider.Secret, error) {
+	apiPath := path
+	if apiPath != "/" {
+		apiPath = strings.TrimSuffix(apiPath, "/")
+	}
+
+	input := &ssm.GetParametersByPathInput{
+		Path:           aws.String(apiPath),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	}
+
+	data := map[string]string{}
+	err := p.client.GetParametersByPathPagesWithContext(ctx, input, func(page *ssm.GetParametersByPathOutput, lastPage bool) bool {
+		for _, parameter := range page.Parameters {
+			key := strings.TrimPrefix(aws.StringValue(parameter.Name), path)
+			data[key] = aws.StringValue(parameter.Value)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("failed to get parameters by path %s: %w", path, err))
+	}
+	if len(data) == 0 {
+		return nil, &provider.Error{Code: ssm.ErrCodeParameterNotFound, Err: fmt.Errorf("no parameters found below %s", path)}
+	}
+
+	value, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &provider.Secret{
+		Name:  path,
+		Value: value,
+		Metadata: map[string]string{
+			"path": path,
+		},
+	}, nil
+}
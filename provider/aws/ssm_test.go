@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+// fakeSSM serves parameters from memory, methods not overridden panic
+type fakeSSM struct {
+	SSMAPI
+	parameters []*ssm.Parameter
+	// pageSize is the number of parameters per page of GetParametersByPath
+	pageSize int
+}
+
+func (f *fakeSSM) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, opts ...request.Option) (*ssm.GetParameterOutput, error) {
+	if !aws.BoolValue(input.WithDecryption) {
+		return nil, awserr.New("ValidationException", "parameters must be decrypted", nil)
+	}
+	for _, parameter := range f.parameters {
+		if aws.StringValue(parameter.Name) == aws.StringValue(input.Name) {
+			return &ssm.GetParameterOutput{Parameter: parameter}, nil
+		}
+	}
+	return nil, awserr.New(ssm.ErrCodeParameterNotFound, "parameter not found", nil)
+}
+
+func (f *fakeSSM) GetParametersByPathPagesWithContext(ctx aws.Context, input *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool, opts ...request.Option) error {
+	if !aws.BoolValue(input.Recursive) || !aws.BoolValue(input.WithDecryption) {
+		return awserr.New("ValidationException", "parameters must be fetched recursively and decrypted", nil)
+	}
+
+	path := aws.StringValue(input.Path)
+	if path != "/" {
+		path += "/"
+	}
+	var matching []*ssm.Parameter
+	for _, parameter := range f.parameters {
+		if strings.HasPrefix(aws.StringValue(parameter.Name), path) {
+			matching = append(matching, parameter)
+		}
+	}
+
+	for len(matching) > f.pageSize {
+		if !fn(&ssm.GetParametersByPathOutput{Parameters: matching[:f.pageSize]}, false) {
+			return nil
+		}
+		matching = matching[f.pageSize:]
+	}
+	fn(&ssm.GetParametersByPathOutput{Parameters: matching}, true)
+	return nil
+}
+
+func newTestSSMProvider() *SSMProvider {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &SSMProvider{client: &fakeSSM{
+		pageSize: 1,
+		parameters: []*ssm.Parameter{
+			{Name: aws.String("/app/prod/db/password"), Value: aws.String("hunter2"), Version: aws.Int64(3), Type: aws.String("SecureString"), LastModifiedDate: &modified, ARN: aws.String("arn:aws:ssm:eu-west-1:123:parameter/app/prod/db/password")},
+			{Name: aws.String("/app/prod/api-key"), Value: aws.String("k"), Version: aws.Int64(1), Type: aws.String("SecureString")},
+			{Name: aws.String("/app/staging/api-key"), Value: aws.String("s"), Version: aws.Int64(1), Type: aws.String("SecureString")},
+		},
+	}}
+}
+
+func TestSSMGetSecret(t *testing.T) {
+	p := newTestSSMProvider()
+
+	secret, err := p.GetSecret(context.Background(), "/app/prod/db/password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Value) != "hunter2" {
+		t.Errorf("value = %q", secret.Value)
+	}
+	if secret.Version != "3" {
+		t.Errorf("version = %q, want 3", secret.Version)
+	}
+	if secret.CreatedAt.Year() != 2024 {
+		t.Errorf("created at = %v", secret.CreatedAt)
+	}
+	if secret.Metadata["type"] != "SecureString" || secret.Metadata["arn"] == "" {
+		t.Errorf("metadata = %v", secret.Metadata)
+	}
+}
+
+func TestSSMGetSecretByPath(t *testing.T) {
+	p := newTestSSMProvider()
+
+	secret, err := p.GetSecret(context.Background(), "/app/prod/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := secret.KeyValues()
+	if !ok {
+		t.Fatalf("value is not a JSON object: %s", secret.Value)
+	}
+	if len(data) != 2 || data["db/password"] != "hunter2" || data["api-key"] != "k" {
+		t.Errorf("data = %v", data)
+	}
+	if secret.Version != "" {
+		t.Errorf("parameter hierarchies have no version, got %q", secret.Version)
+	}
+}
+
+func TestSSMGetSecretNotFound(t *testing.T) {
+	p := newTestSSMProvider()
+
+	for _, name := range []string{"/app/prod/missing", "/app/missing/"} {
+		_, err := p.GetSecret(context.Background(), name)
+		if !provider.IsNotFound(err) {
+			t.Errorf("%s: expected not found error, got %v", name, err)
+		}
+		if code := provider.ErrorCode(err); code != ssm.ErrCodeParameterNotFound {
+			t.Errorf("%s: code = %q", name, code)
+		}
+	}
+}
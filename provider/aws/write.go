@@ -0,0 +1,118 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+func (p *AWSProvider) CreateSecret(ctx context.Context, name string, value []byte, tags map[string]string) (string, error) {
+	input := &secretsmanager.CreateSecretInput{
+		Name: aws.String(name),
+	}
+	// Text is stored as SecretString, so it is readable in the console and usable for key/value secrets
+	if utf8.Valid(value) {
+		input.SecretString = aws.String(string(value))
+	} else {
+		input.SecretBinary = value
+	}
+	for k, v := range tags {
+		input.Tags = append(input.Tags, &secretsmanager.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+
+	result, err := p.client.CreateSecretWithContext(ctx, input)
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == secretsmanager.ErrCodeResourceExistsException {
+			return "", &provider.Error{Code: aerr.Code(), Err: fmt.Errorf("%w: %s", provider.ErrSecretExists, name)}
+		}
+		return "", wrapError(fmt.Errorf("failed to create secret %s: %w", name, err))
+	}
+
+	return aws.StringValue(result.VersionId), nil
+}
+
+func (p *AWSProvider) UpdateSecret(ctx context.Context, name string, value []byte) (string, error) {
+	input := &secretsmanager.PutSecretValueInput{
+		SecretId: aws.String(name),
+	}
+	if utf8.Valid(value) {
+		input.SecretString = aws.String(string(value))
+	} else {
+		input.SecretBinary = value
+	}
+
+	result, err := p.client.PutSecretValueWithContext(ctx, input)
+	if err != nil {
+		return "", wrapError(fmt.Errorf("failed to update secret %s: %w", name, err))
+	}
+
+	return aws.StringValue(result.VersionId), nil
+}
+
+// DeleteSecret schedules the deletion of a secret after the recovery window,
+// or deletes it immediately if force delete is enabled.
+func (p *AWSProvider) DeleteSecret(ctx context.Context, name string) error {
+	input := &secretsmanager.DeleteSecretInput{
+		SecretId: aws.String(name),
+	}
+	if p.forceDelete {
+		input.ForceDeleteWithoutRecovery = aws.Bool(true)
+	}
+
+	if _, err := p.client.DeleteSecretWithContext(ctx, input); err != nil {
+		return wrapError(fmt.Errorf("failed to delete secret %s: %w", name, err))
+	}
+
+	return nil
+}
+
+// SetSecretTags removes the tags of a secret missing in tags and adds or updates the others
+func (p *AWSProvider) SetSecretTags(ctx context.Context, name string, tags map[string]string) error {
+	existing, err := p.GetSecretTags(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var remove []string
+	for k := range existing {
+		if _, ok := tags[k]; !ok {
+			remove = append(remove, k)
+		}
+	}
+	if len(remove) > 0 {
+		_, err := p.client.UntagResourceWithContext(ctx, &secretsmanager.UntagResourceInput{
+			SecretId: aws.String(name),
+			TagKeys:  aws.StringSlice(remove),
+		})
+		if err != nil {
+			return wrapError(fmt.Errorf("failed to untag secret %s: %w", name, err))
+		}
+	}
+
+	if len(tags) > 0 {
+		input := &secretsmanager.TagResourceInput{
+			SecretId: aws.String(name),
+		}
+		for k, v := range tags {
+			input.Tags = append(input.Tags, &secretsmanager.Tag{
+				Key:   aws.String(k),
+				Value: aws.String(v),
+			})
+		}
+		if _, err := p.client.TagResourceWithContext(ctx, input); err != nil {
+			return wrapError(fmt.Errorf("failed to tag secret %s: %w", name, err))
+		}
+	}
+
+	return nil
+}
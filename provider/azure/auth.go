@@ -0,0 +1,100 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+// newAuthorizer returns a Key Vault authorizer for the configured auth method.
+// Tenant, client ID and federated token file default to the AZURE_* variables,
+// which are injected by AKS workload identity.
+func newAuthorizer(azureConfig AzureConfig, env azure.Environment) (autorest.Authorizer, error) {
+	resource := strings.TrimSuffix(env.ResourceIdentifiers.KeyVault, "/")
+	tenantID := valueOrEnv(azureConfig.TenantID, auth.TenantID)
+	clientID := valueOrEnv(azureConfig.ClientID, auth.ClientID)
+
+	log.Infof("Using Azure auth method: %s", azureConfig.AuthMethod)
+	switch azureConfig.AuthMethod {
+	case "", "cli":
+		return auth.NewAuthorizerFromCLIWithResource(resource)
+	case "client-secret":
+		config := auth.NewClientCredentialsConfig(clientID, valueOrEnv(azureConfig.ClientSecret, auth.ClientSecret), tenantID)
+		config.Resource = resource
+		config.AADEndpoint = env.ActiveDirectoryEndpoint
+		return config.Authorizer()
+	case "client-certificate":
+		config := auth.NewClientCertificateConfig(
+			valueOrEnv(azureConfig.ClientCertificatePath, auth.CertificatePath),
+			valueOrEnv(azureConfig.ClientCertificatePassword, auth.CertificatePassword),
+			clientID,
+			tenantID,
+		)
+		config.Resource = resource
+		config.AADEndpoint = env.ActiveDirectoryEndpoint
+		return config.Authorizer()
+	case "managed-identity":
+		config := auth.NewMSIConfig()
+		config.Resource = resource
+		// The client ID selects a user-assigned identity, the system-assigned identity is used otherwise
+		config.ClientID = azureConfig.ClientID
+		return config.Authorizer()
+	case "workload-identity":
+		readToken := azureConfig.FederatedToken
+		if readToken == nil {
+			tokenFile := valueOrEnv(azureConfig.FederatedTokenFile, "AZURE_FEDERATED_TOKEN_FILE")
+			if tokenFile == "" {
+				return nil, errors.New("workload identity requires a federated token file")
+			}
+			readToken = fileToken(tokenFile)
+		}
+		return newWorkloadIdentityAuthorizer(env, resource, tenantID, clientID, readToken)
+	default:
+		return nil, fmt.Errorf("unsupported Azure auth method: %s", azureConfig.AuthMethod)
+	}
+}
+
+// newWorkloadIdentityAuthorizer exchanges a federated token, e.g. a service account token, for an access token.
+// The token is read on every refresh, as it expires.
+func newWorkloadIdentityAuthorizer(env azure.Environment, resource, tenantID, clientID string, readToken func() (string, error)) (autorest.Authorizer, error) {
+	if tenantID == "" || clientID == "" {
+		return nil, errors.New("workload identity requires a tenant ID and client ID")
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	spt, err := adal.NewServicePrincipalTokenFromFederatedTokenCallback(*oauthConfig, clientID, readToken, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	return autorest.NewBearerAuthorizer(spt), nil
+}
+
+// fileToken reads a token file, e.g. the projected service account token rotated by the kubelet
+func fileToken(tokenFile string) func() (string, error) {
+	return func() (string, error) {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read federated token file: %w", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+}
+
+func valueOrEnv(value string, envVar string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(envVar)
+}
@@ -2,51 +2,261 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Azure/azure-sdk-for-go/services/keyvault/v7.0/keyvault"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
 
-	kvauth "github.com/Azure/azure-sdk-for-go/services/keyvault/auth"
 	"github.com/kvendingoldo/cloud-secrets/provider"
-	"os"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type AzureProvider struct {
 	provider.BaseProvider
-	client   *keyvault.BaseClient
-	vaultURL string
+	client *keyvault.BaseClient
+	// vaults in the configured order
+	vaults []keyVault
+}
+
+// keyVault is a Key Vault with the name secrets can be qualified with, e.g. "myvault/db-password"
+type keyVault struct {
+	name string
+	url  string
 }
 
 type AzureConfig struct {
 	Region        string
 	ResourceGroup string
-	KeyVault      string
+	// KeyVaults by name, the URL is derived from the cloud environment
+	KeyVaults []string
+	// VaultURLs of additional vaults, e.g. for custom Key Vault endpoints
+	VaultURLs []string
+	// Environment is the name of the Azure cloud, e.g. AzureUSGovernmentCloud (default: AzurePublicCloud)
+	Environment string
+
+	// AuthMethod is one of cli, client-secret, client-certificate, managed-identity, workload-identity
+	AuthMethod                string
+	TenantID                  string
+	ClientID                  string
+	ClientSecret              string
+	ClientCertificatePath     string
+	ClientCertificatePassword string
+	FederatedTokenFile        string
+	// FederatedToken returns the token of the workload-identity auth method instead of FederatedTokenFile (optional)
+	FederatedToken func() (string, error)
 }
 
 func NewAzureProvider(azureConfig AzureConfig) (*AzureProvider, error) {
-	// TODO: need check auth method later
-	authorizer, err := kvauth.NewAuthorizerFromCLI()
+	env := azure.PublicCloud
+	if azureConfig.Environment != "" {
+		var err error
+		env, err = azure.EnvironmentFromName(azureConfig.Environment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var vaults []keyVault
+	for _, name := range azureConfig.KeyVaults {
+		vaults = append(vaults, keyVault{
+			name: name,
+			url:  fmt.Sprintf("https://%s.%s", name, env.KeyVaultDNSSuffix),
+		})
+	}
+	for _, vaultURL := range azureConfig.VaultURLs {
+		u, err := url.Parse(vaultURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid vault URL: %s", vaultURL)
+		}
+		vaults = append(vaults, keyVault{
+			name: strings.SplitN(u.Hostname(), ".", 2)[0],
+			url:  strings.TrimSuffix(vaultURL, "/"),
+		})
+	}
+	if len(vaults) == 0 {
+		return nil, errors.New("no key vault specified")
+	}
+
+	authorizer, err := newAuthorizer(azureConfig, env)
 	if err != nil {
-		fmt.Printf("unable to create vault authorizer: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("unable to create vault authorizer: %w", err)
 	}
 
 	keyClient := keyvault.New()
 	keyClient.Authorizer = authorizer
 
 	provider := &AzureProvider{
-		client:   &keyClient,
-		vaultURL: fmt.Sprintf("https://%s.%s", azureConfig.KeyVault, azure.PublicCloud.KeyVaultDNSSuffix),
+		client: &keyClient,
+		vaults: vaults,
 	}
 
 	return provider, nil
 }
 
-func (p *AzureProvider) GetSecret(name string) {
+// GetSecret fetches a secret by name, which may be qualified with the vault name as "{vault}/{name}".
+// Unqualified secrets are looked up in all vaults in order, the first vault having the secret wins.
+func (p *AzureProvider) GetSecret(ctx context.Context, name string) (*provider.Secret, error) {
+	vaults := p.vaults
+	secretName := name
+	if vaultName, qualifiedName, ok := strings.Cut(name, "/"); ok {
+		vaults = nil
+		for _, v := range p.vaults {
+			if v.name == vaultName {
+				vaults = append(vaults, v)
+			}
+		}
+		if len(vaults) == 0 {
+			return nil, fmt.Errorf("unknown key vault %s of secret %s", vaultName, name)
+		}
+		secretName = qualifiedName
+	}
+
+	var err error
+	for _, v := range vaults {
+		var secret *provider.Secret
+		secret, err = p.getSecret(ctx, v, secretName)
+		if err == nil {
+			secret.Name = name
+			return secret, nil
+		}
+		if provider.ErrorCode(err) != strconv.Itoa(http.StatusNotFound) {
+			return nil, err
+		}
+	}
 
-	secretResp, err := p.client.GetSecret(context.Background(), p.vaultURL, name, "")
+	return nil, err
+}
+
+func (p *AzureProvider) getSecret(ctx context.Context, v keyVault, name string) (*provider.Secret, error) {
+	// An empty version returns the latest version of the secret
+	secretResp, err := p.client.GetSecret(ctx, v.url, name, "")
 	if err != nil {
-		fmt.Printf("unable to get value for secret: %v\n", err)
+		return nil, wrapError(fmt.Errorf("unable to get value for secret %s from %s: %w", name, v.name, err))
+	}
+	if secretResp.Value == nil {
+		return nil, fmt.Errorf("secret %s has no value", name)
+	}
+
+	// The secret ID has the form https://{vault}/secrets/{name}/{version}
+	var id, version string
+	if secretResp.ID != nil {
+		id = *secretResp.ID
+		version = id[strings.LastIndex(id, "/")+1:]
+	}
+
+	metadata := map[string]string{
+		"id":    id,
+		"vault": v.name,
+	}
+	if secretResp.ContentType != nil {
+		metadata["contentType"] = *secretResp.ContentType
+	}
+	for k, v := range secretResp.Tags {
+		if v != nil {
+			metadata["tag."+k] = *v
+		}
+	}
+
+	var createdAt time.Time
+	if secretResp.Attributes != nil && secretResp.Attributes.Created != nil {
+		createdAt = time.Time(*secretResp.Attributes.Created)
+	}
+
+	return &provider.Secret{
+		Name:      name,
+		Value:     []byte(*secretResp.Value),
+		Version:   version,
+		CreatedAt: createdAt,
+		Metadata:  metadata,
+	}, nil
+}
+
+// GetSecretTags returns the tags of the latest version of a secret
+func (p *AzureProvider) GetSecretTags(ctx context.Context, name string) (map[string]string, error) {
+	secret, err := p.GetSecret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]string{}
+	for k, v := range secret.Metadata {
+		if tag, ok := strings.CutPrefix(k, "tag."); ok {
+			tags[tag] = v
+		}
+	}
+
+	return tags, nil
+}
+
+// ListSecrets lists the secrets of all vaults. If multiple vaults are configured,
+// the names are qualified with the vault name, so they can be passed to GetSecret.
+func (p *AzureProvider) ListSecrets(ctx context.Context, selector provider.Selector) ([]string, error) {
+	var names []string
+	for _, v := range p.vaults {
+		vaultNames, err := p.listSecrets(ctx, v, selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range vaultNames {
+			if len(p.vaults) > 1 {
+				name = v.name + "/" + name
+			}
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+func (p *AzureProvider) listSecrets(ctx context.Context, v keyVault, selector provider.Selector) ([]string, error) {
+	var names []string
+	it, err := p.client.GetSecretsComplete(ctx, v.url, nil)
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("unable to list secrets of %s: %w", v.name, err))
+	}
+	for ; it.NotDone(); err = it.NextWithContext(ctx) {
+		if err != nil {
+			return nil, wrapError(fmt.Errorf("unable to list secrets of %s: %w", v.name, err))
+		}
+
+		item := it.Value()
+		if item.ID == nil {
+			continue
+		}
+		if item.Attributes != nil && item.Attributes.Enabled != nil && !*item.Attributes.Enabled {
+			continue
+		}
+
+		tags := make(map[string]string, len(item.Tags))
+		for k, value := range item.Tags {
+			if value != nil {
+				tags[k] = *value
+			}
+		}
+
+		// The secret ID has the form https://{vault}/secrets/{name}
+		name := (*item.ID)[strings.LastIndex(*item.ID, "/")+1:]
+		if selector.Matches(name, tags) {
+			names = append(names, name)
+		}
+	}
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("unable to list secrets of %s: %w", v.name, err))
+	}
+
+	return names, nil
+}
+
+// wrapError attaches the HTTP status code of autorest errors to err
+func wrapError(err error) error {
+	var derr autorest.DetailedError
+	if errors.As(err, &derr) && derr.StatusCode != nil {
+		return &provider.Error{Code: fmt.Sprint(derr.StatusCode), Err: err}
 	}
-	fmt.Println(*secretResp.Value)
+	return err
 }
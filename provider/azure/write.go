@@ -0,0 +1,139 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/keyvault/v7.0/keyvault"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+// validSecretName matches the names Key Vault accepts for secrets
+var validSecretName = regexp.MustCompile(`^[0-9a-zA-Z-]{1,127}$`)
+
+// writeVault returns the vault a secret is written to, which is the vault the name is qualified with
+// or the first configured vault, and the unqualified secret name.
+// As secret names can't contain "/", a name like "prod/db" always refers to secret db of vault prod,
+// e.g. names copied from AWS need an alias.
+func (p *AzureProvider) writeVault(name string) (keyVault, string, error) {
+	vault := p.vaults[0]
+	vaultName, secretName, ok := strings.Cut(name, "/")
+	if ok {
+		vault = keyVault{}
+		for _, v := range p.vaults {
+			if v.name == vaultName {
+				vault = v
+			}
+		}
+		if vault.name == "" {
+			return keyVault{}, "", fmt.Errorf("unknown key vault %s of secret %s, names qualified with a vault are in the form {vault}/{name}", vaultName, name)
+		}
+	} else {
+		secretName = name
+	}
+
+	if !validSecretName.MatchString(secretName) {
+		return keyVault{}, "", fmt.Errorf("invalid secret name %s, key vault secret names may only contain alphanumerics and dashes", secretName)
+	}
+	return vault, secretName, nil
+}
+
+// CreateSecret creates a secret. As Key Vault creates secrets implicitly when setting a value,
+// the existence of the secret is checked beforehand.
+func (p *AzureProvider) CreateSecret(ctx context.Context, name string, value []byte, tags map[string]string) (string, error) {
+	v, secretName, err := p.writeVault(name)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = p.getSecret(ctx, v, secretName)
+	if err == nil {
+		return "", &provider.Error{Code: strconv.Itoa(http.StatusConflict), Err: fmt.Errorf("%w: %s", provider.ErrSecretExists, name)}
+	}
+	if provider.ErrorCode(err) != strconv.Itoa(http.StatusNotFound) {
+		return "", err
+	}
+
+	return p.setSecret(ctx, v, secretName, value, tags)
+}
+
+func (p *AzureProvider) UpdateSecret(ctx context.Context, name string, value []byte) (string, error) {
+	v, secretName, err := p.writeVault(name)
+	if err != nil {
+		return "", err
+	}
+
+	return p.setSecret(ctx, v, secretName, value, nil)
+}
+
+// DeleteSecret deletes a secret, which is kept as a deleted secret if soft-delete is enabled for the vault.
+func (p *AzureProvider) DeleteSecret(ctx context.Context, name string) error {
+	v, secretName, err := p.writeVault(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.client.DeleteSecret(ctx, v.url, secretName); err != nil {
+		return wrapError(fmt.Errorf("unable to delete secret %s from %s: %w", secretName, v.name, err))
+	}
+
+	return nil
+}
+
+// SetSecretTags replaces the tags of the latest version of a secret, as Key Vault tags belong to versions
+func (p *AzureProvider) SetSecretTags(ctx context.Context, name string, tags map[string]string) error {
+	v, secretName, err := p.writeVault(name)
+	if err != nil {
+		return err
+	}
+
+	secret, err := p.getSecret(ctx, v, secretName)
+	if err != nil {
+		return err
+	}
+
+	params := keyvault.SecretUpdateParameters{
+		Tags: make(map[string]*string, len(tags)),
+	}
+	for k, t := range tags {
+		params.Tags[k] = stringPtr(t)
+	}
+	if _, err := p.client.UpdateSecret(ctx, v.url, secretName, secret.Version, params); err != nil {
+		return wrapError(fmt.Errorf("unable to set tags of secret %s in %s: %w", secretName, v.name, err))
+	}
+
+	return nil
+}
+
+// setSecret adds a new version to a secret, creating the secret if needed
+func (p *AzureProvider) setSecret(ctx context.Context, v keyVault, name string, value []byte, tags map[string]string) (string, error) {
+	params := keyvault.SecretSetParameters{
+		Value: stringPtr(string(value)),
+	}
+	if len(tags) > 0 {
+		params.Tags = make(map[string]*string, len(tags))
+		for k, t := range tags {
+			params.Tags[k] = stringPtr(t)
+		}
+	}
+
+	result, err := p.client.SetSecret(ctx, v.url, name, params)
+	if err != nil {
+		return "", wrapError(fmt.Errorf("unable to set secret %s in %s: %w", name, v.name, err))
+	}
+
+	var version string
+	if result.ID != nil {
+		version = (*result.ID)[strings.LastIndex(*result.ID, "/")+1:]
+	}
+
+	return version, nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,197 @@
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"gopkg.in/yaml.v3"
+)
+
+// FileProvider reads secrets from the local filesystem, e.g. for development without cloud credentials.
+// The path is either a directory, where every file is a secret named by its path relative to the directory,
+// or a JSON or YAML document mapping secret names to values. Values which are not strings, e.g. objects,
+// are returned as JSON, so they can be used as key/value secrets.
+//
+// The version of a secret is a hash of its value and its creation time the modification time of the file,
+// so the secrets are picked up again whenever a file changes.
+type FileProvider struct {
+	provider.BaseProvider
+	path string
+	dir  bool
+}
+
+type FileConfig struct {
+	// Path of a directory or of a JSON or YAML document
+	Path string
+}
+
+func NewFileProvider(fileConfig FileConfig) (*FileProvider, error) {
+	info, err := os.Stat(fileConfig.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup file provider: %w", err)
+	}
+
+	provider := &FileProvider{
+		path: fileConfig.Path,
+		dir:  info.IsDir(),
+	}
+
+	return provider, nil
+}
+
+func (p *FileProvider) GetSecret(ctx context.Context, name string) (*provider.Secret, error) {
+	if !p.dir {
+		return p.getDocumentSecret(name)
+	}
+
+	path, err := p.secretPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, notFound(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", name, err)
+	}
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", name, err)
+	}
+
+	// Editors usually terminate files with a newline, which is not part of the secret
+	value = []byte(strings.TrimSuffix(strings.TrimSuffix(string(value), "\n"), "\r"))
+
+	return newSecret(name, value, path, info.ModTime()), nil
+}
+
+// getDocumentSecret reads a secret from the JSON or YAML document
+func (p *FileProvider) getDocumentSecret(name string) (*provider.Secret, error) {
+	doc, modTime, err := p.readDocument()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, ok := doc[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+
+	var value []byte
+	if s, ok := raw.(string); ok {
+		value = []byte(s)
+	} else {
+		value, err = json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode secret %s: %w", name, err)
+		}
+	}
+
+	return newSecret(name, value, p.path, modTime), nil
+}
+
+// readDocument parses the document, JSON is parsed as YAML as it is a subset of it
+func (p *FileProvider) readDocument() (map[string]interface{}, time.Time, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read %s: %w", p.path, err)
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read %s: %w", p.path, err)
+	}
+
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse %s: %w", p.path, err)
+	}
+
+	return doc, info.ModTime(), nil
+}
+
+// secretPath returns the path of a secret in the directory, names must not escape the directory
+func (p *FileProvider) secretPath(name string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("invalid secret name: %s", name)
+	}
+	return filepath.Join(p.path, filepath.FromSlash(name)), nil
+}
+
+// ListSecrets lists all secrets, hidden files in the directory are skipped.
+// As files have no tags, secrets only match selectors without tags.
+func (p *FileProvider) ListSecrets(ctx context.Context, selector provider.Selector) ([]string, error) {
+	var names []string
+	if !p.dir {
+		doc, _, err := p.readDocument()
+		if err != nil {
+			return nil, err
+		}
+		for name := range doc {
+			if selector.Matches(name, nil) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	err := filepath.WalkDir(p.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != p.path && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.path, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if selector.Matches(name, nil) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	return names, nil
+}
+
+func newSecret(name string, value []byte, path string, modTime time.Time) *provider.Secret {
+	sum := sha256.Sum256(value)
+	return &provider.Secret{
+		Name:      name,
+		Value:     value,
+		Version:   hex.EncodeToString(sum[:])[:12],
+		CreatedAt: modTime,
+		Metadata: map[string]string{
+			"path": path,
+		},
+	}
+}
+
+func notFound(name string) error {
+	return &provider.Error{Code: "NotFound", Err: fmt.Errorf("secret %s not found", name)}
+}
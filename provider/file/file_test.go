@@ -0,0 +1,154 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+func writeFile(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestProvider(t *testing.T, path string) *FileProvider {
+	t.Helper()
+	p, err := NewFileProvider(FileConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestGetSecretDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "db"), "hunter2\n")
+	writeFile(t, filepath.Join(dir, "prod", "api"), `{"key":"k"}`)
+	p := newTestProvider(t, dir)
+
+	secret, err := p.GetSecret(context.Background(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Value) != "hunter2" {
+		t.Errorf("value = %q, the trailing newline should be trimmed", secret.Value)
+	}
+	if secret.Version == "" || secret.CreatedAt.IsZero() {
+		t.Errorf("version = %q, created at = %v", secret.Version, secret.CreatedAt)
+	}
+
+	nested, err := p.GetSecret(context.Background(), "prod/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := nested.KeyValues(); !ok || data["key"] != "k" {
+		t.Errorf("value = %s", nested.Value)
+	}
+
+	writeFile(t, filepath.Join(dir, "db"), "hunter3\n")
+	changed, err := p.GetSecret(context.Background(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Version == secret.Version {
+		t.Error("version didn't change with the value")
+	}
+}
+
+func TestGetSecretDocument(t *testing.T) {
+	for _, doc := range []struct {
+		name string
+		data string
+	}{
+		{name: "secrets.yaml", data: "db: hunter2\napi:\n  key: k\n  port: 5432\n"},
+		{name: "secrets.json", data: `{"db": "hunter2", "api": {"key": "k", "port": 5432}}`},
+	} {
+		t.Run(doc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), doc.name)
+			writeFile(t, path, doc.data)
+			p := newTestProvider(t, path)
+
+			secret, err := p.GetSecret(context.Background(), "db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(secret.Value) != "hunter2" {
+				t.Errorf("value = %q", secret.Value)
+			}
+
+			api, err := p.GetSecret(context.Background(), "api")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, ok := api.KeyValues()
+			if !ok || !reflect.DeepEqual(data, map[string]string{"key": "k", "port": "5432"}) {
+				t.Errorf("value = %s", api.Value)
+			}
+		})
+	}
+}
+
+func TestGetSecretPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "outside"), "leaked")
+	dir := filepath.Join(root, "secrets")
+	writeFile(t, filepath.Join(dir, "db"), "hunter2")
+	p := newTestProvider(t, dir)
+
+	for _, name := range []string{"../outside", "prod/../../outside", "/etc/passwd", ""} {
+		secret, err := p.GetSecret(context.Background(), name)
+		if err == nil {
+			t.Errorf("%q: expected error, got %q", name, secret.Value)
+		}
+		if provider.IsNotFound(err) {
+			t.Errorf("%q: invalid name reported as not found", name)
+		}
+	}
+}
+
+func TestGetSecretNotFound(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.yaml")
+	writeFile(t, path, "db: hunter2\n")
+
+	for _, p := range []*FileProvider{newTestProvider(t, dir), newTestProvider(t, path)} {
+		_, err := p.GetSecret(context.Background(), "missing")
+		if !provider.IsNotFound(err) {
+			t.Errorf("%s: expected not found error, got %v", p.path, err)
+		}
+	}
+}
+
+func TestListSecrets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "db"), "hunter2")
+	writeFile(t, filepath.Join(dir, "prod", "api"), "k")
+	writeFile(t, filepath.Join(dir, ".hidden"), "x")
+	writeFile(t, filepath.Join(dir, "..data", "db"), "x")
+	p := newTestProvider(t, dir)
+
+	names, err := p.ListSecrets(context.Background(), provider.Selector{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"db", "prod/api"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	names, err = p.ListSecrets(context.Background(), provider.Selector{NamePrefix: "prod/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"prod/api"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
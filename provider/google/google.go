@@ -4,10 +4,20 @@ import (
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kvendingoldo/cloud-secrets/provider"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 type GoogleProvider struct {
@@ -15,44 +25,268 @@ type GoogleProvider struct {
 	client        *secretmanager.Client
 	projectId     string
 	secretVersion string
+	fallback      bool
 }
 
 type GoogleConfig struct {
 	ProjectId     string
 	SecretVersion string
+
+	// CredentialsFile is a service account key or other credentials JSON file, application default credentials are used otherwise
+	CredentialsFile string
+	// CredentialsJSON holds credentials like CredentialsFile, e.g. read from a Kubernetes Secret
+	CredentialsJSON []byte
+	// ImpersonateServiceAccount is the service account to impersonate (optional)
+	ImpersonateServiceAccount string
+	// ImpersonateDelegates is the delegation chain to the impersonated service account (optional)
+	ImpersonateDelegates []string
+	// Endpoint overrides the Secret Manager API endpoint, e.g. a local emulator
+	Endpoint string
+	// Insecure disables TLS and authentication, only intended for emulators
+	Insecure bool
+
+	// FallbackToEnabled falls back to the most recent enabled version if the requested version is disabled or destroyed
+	FallbackToEnabled bool
 }
 
 func NewGoogleProvider(googleConfig GoogleConfig) (*GoogleProvider, error) {
-
 	ctx := context.Background()
-	client, err := secretmanager.NewClient(ctx)
+
+	opts, err := clientOptions(ctx, googleConfig)
 	if err != nil {
-		log.Fatalf("failed to setup client: %v", err)
+		return nil, err
+	}
+
+	client, err := secretmanager.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup client: %w", err)
 	}
 
 	provider := &GoogleProvider{
 		client:        client,
 		projectId:     googleConfig.ProjectId,
 		secretVersion: googleConfig.SecretVersion,
+		fallback:      googleConfig.FallbackToEnabled,
 	}
 
 	return provider, nil
 }
 
-func (p *GoogleProvider) GetSecret(name string) {
-	ctx := context.Background()
+// clientOptions returns the client options for the configured credentials and endpoint
+func clientOptions(ctx context.Context, googleConfig GoogleConfig) ([]option.ClientOption, error) {
+	var opts []option.ClientOption
+	if googleConfig.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(googleConfig.Endpoint))
+	}
+	if googleConfig.Insecure {
+		return append(opts,
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		), nil
+	}
+
+	var credentialOpts []option.ClientOption
+	if googleConfig.CredentialsFile != "" {
+		credentialOpts = append(credentialOpts, option.WithCredentialsFile(googleConfig.CredentialsFile))
+	}
+	if len(googleConfig.CredentialsJSON) > 0 {
+		credentialOpts = append(credentialOpts, option.WithCredentialsJSON(googleConfig.CredentialsJSON))
+	}
+
+	if googleConfig.ImpersonateServiceAccount == "" {
+		return append(opts, credentialOpts...), nil
+	}
+
+	log.Infof("Impersonating service account: %s", googleConfig.ImpersonateServiceAccount)
+	ts, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: googleConfig.ImpersonateServiceAccount,
+		Delegates:       googleConfig.ImpersonateDelegates,
+		Scopes:          secretmanager.DefaultAuthScopes(),
+	}, credentialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to impersonate %s: %w", googleConfig.ImpersonateServiceAccount, err)
+	}
+
+	return append(opts, option.WithTokenSource(ts)), nil
+}
+
+// Close closes the connection of the client
+func (p *GoogleProvider) Close() error {
+	return p.client.Close()
+}
+
+func (p *GoogleProvider) GetSecret(ctx context.Context, name string) (*provider.Secret, error) {
+	return p.GetSecretVersion(ctx, name, p.secretVersion)
+}
 
-	fmt.Println("projects/" + p.projectId + "/secrets/" + name + "/versions/" + p.secretVersion)
+// GetSecretVersion fetches a version of a secret, which is either a version number, "latest" or a version alias.
+// If the version is disabled or destroyed and fallback is enabled, the most recent enabled version is returned instead.
+func (p *GoogleProvider) GetSecretVersion(ctx context.Context, name string, version string) (*provider.Secret, error) {
+	secretName := "projects/" + p.projectId + "/secrets/" + name
 
-	req := &secretmanagerpb.AccessSecretVersionRequest{
-		Name: "projects/" + p.projectId + "/secrets/" + name + "/versions/" + p.secretVersion,
+	if !isVersionNumber(version) {
+		var err error
+		version, err = p.resolveAlias(ctx, secretName, version)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Call the API.
-	result, err := p.client.AccessSecretVersion(ctx, req)
+	result, err := p.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: secretName + "/versions/" + version,
+	})
+	// Disabled and destroyed versions can't be accessed
+	if status.Code(err) == codes.FailedPrecondition && p.fallback {
+		var fallbackVersion string
+		fallbackVersion, err = p.latestEnabledVersion(ctx, secretName)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Warnf("Version %s of secret %s is not enabled, falling back to version %s", version, name, fallbackVersion)
+		result, err = p.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+			Name: secretName + "/versions/" + fallbackVersion,
+		})
+	}
+	if err != nil {
+		return nil, wrapError(err, fmt.Errorf("failed to get secret %s: %w", name, err))
+	}
+
+	// The returned name is always fully resolved, e.g. "latest" becomes the actual version number
+	resolved := result.Name[strings.LastIndex(result.Name, "/")+1:]
+
+	return &provider.Secret{
+		Name:      name,
+		Value:     result.Payload.GetData(),
+		Version:   resolved,
+		CreatedAt: p.createTime(ctx, result.Name),
+		Metadata: map[string]string{
+			"name":             result.Name,
+			"requestedVersion": version,
+		},
+	}, nil
+}
+
+// createTime returns the creation time of a secret version, or the zero time if it can't be read.
+// Reading version metadata requires a permission beyond secret access, so failures are not fatal.
+func (p *GoogleProvider) createTime(ctx context.Context, versionName string) time.Time {
+	version, err := p.client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{
+		Name: versionName,
+	})
 	if err != nil {
-		log.Infof("failed to get secret: %v", err)
+		log.Debugf("Failed to get the creation time of %s: %v", versionName, err)
+		return time.Time{}
 	}
+	return version.GetCreateTime().AsTime()
+}
+
+// isVersionNumber reports whether version can be accessed directly, i.e. is a number or "latest"
+func isVersionNumber(version string) bool {
+	if version == "latest" {
+		return true
+	}
+	_, err := strconv.ParseUint(version, 10, 64)
+	return err == nil
+}
+
+// resolveAlias returns the version number the alias points to
+func (p *GoogleProvider) resolveAlias(ctx context.Context, secretName string, alias string) (string, error) {
+	secret, err := p.client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{
+		Name: secretName,
+	})
+	if err != nil {
+		return "", wrapError(err, fmt.Errorf("failed to resolve version alias %s of %s: %w", alias, secretName, err))
+	}
+
+	version, ok := secret.GetVersionAliases()[alias]
+	if !ok {
+		return "", &provider.Error{
+			Code: codes.NotFound.String(),
+			Err:  fmt.Errorf("unknown version alias %s of %s", alias, secretName),
+		}
+	}
+
+	return strconv.FormatInt(version, 10), nil
+}
+
+// latestEnabledVersion returns the most recently created enabled version
+func (p *GoogleProvider) latestEnabledVersion(ctx context.Context, secretName string) (string, error) {
+	var latest *secretmanagerpb.SecretVersion
+	it := p.client.ListSecretVersions(ctx, &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: secretName,
+		Filter: "state:ENABLED",
+	})
+	for {
+		version, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return "", wrapError(err, fmt.Errorf("failed to list versions of %s: %w", secretName, err))
+		}
+
+		if version.GetState() != secretmanagerpb.SecretVersion_ENABLED {
+			continue
+		}
+		if latest == nil || version.GetCreateTime().AsTime().After(latest.GetCreateTime().AsTime()) {
+			latest = version
+		}
+	}
+	if latest == nil {
+		return "", &provider.Error{
+			Code: codes.NotFound.String(),
+			Err:  fmt.Errorf("%s has no enabled version", secretName),
+		}
+	}
+
+	return latest.Name[strings.LastIndex(latest.Name, "/")+1:], nil
+}
+
+func (p *GoogleProvider) ListSecrets(ctx context.Context, selector provider.Selector) ([]string, error) {
+	var filters []string
+	for k, v := range selector.Tags {
+		filters = append(filters, fmt.Sprintf("labels.%s=%s", k, v))
+	}
+
+	req := &secretmanagerpb.ListSecretsRequest{
+		Parent: "projects/" + p.projectId,
+		Filter: strings.Join(filters, " AND "),
+	}
+
+	var names []string
+	it := p.client.ListSecrets(ctx, req)
+	for {
+		secret, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, wrapError(err, fmt.Errorf("failed to list secrets: %w", err))
+		}
+
+		// The secret name has the form projects/{project}/secrets/{name}
+		name := secret.Name[strings.LastIndex(secret.Name, "/")+1:]
+		if selector.Matches(name, secret.Labels) {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+func (p *GoogleProvider) GetSecretTags(ctx context.Context, name string) (map[string]string, error) {
+	secret, err := p.client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{
+		Name: "projects/" + p.projectId + "/secrets/" + name,
+	})
+	if err != nil {
+		return nil, wrapError(err, fmt.Errorf("failed to get labels of secret %s: %w", name, err))
+	}
+
+	return secret.GetLabels(), nil
+}
 
-	fmt.Println(result.Payload)
+// wrapError attaches the gRPC status code of cause to err
+func wrapError(cause error, err error) error {
+	return &provider.Error{Code: status.Code(cause).String(), Err: err}
 }
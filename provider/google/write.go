@@ -0,0 +1,124 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	log "github.com/sirupsen/logrus"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// CreateSecret creates an automatically replicated secret with a first version, the tags are set as labels.
+// Unlike with the other providers these are two separate calls.
+// As labels are more restricted than tags of other providers, tags are mapped by toLabels.
+func (p *GoogleProvider) CreateSecret(ctx context.Context, name string, value []byte, tags map[string]string) (string, error) {
+	_, err := p.client.CreateSecret(ctx, &secretmanagerpb.CreateSecretRequest{
+		Parent:   "projects/" + p.projectId,
+		SecretId: name,
+		Secret: &secretmanagerpb.Secret{
+			Replication: &secretmanagerpb.Replication{
+				Replication: &secretmanagerpb.Replication_Automatic_{
+					Automatic: &secretmanagerpb.Replication_Automatic{},
+				},
+			},
+			Labels: toLabels(tags),
+		},
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return "", &provider.Error{Code: codes.AlreadyExists.String(), Err: fmt.Errorf("%w: %s", provider.ErrSecretExists, name)}
+	}
+	if err != nil {
+		return "", wrapError(err, fmt.Errorf("failed to create secret %s: %w", name, err))
+	}
+
+	// A secret without versions can't be read, so it is deleted again if its first version can't be added
+	version, err := p.UpdateSecret(ctx, name, value)
+	if err != nil {
+		if deleteErr := p.DeleteSecret(ctx, name); deleteErr != nil {
+			log.Errorf("Failed to delete secret %s without versions: %v", name, deleteErr)
+		}
+		return "", err
+	}
+
+	return version, nil
+}
+
+func (p *GoogleProvider) UpdateSecret(ctx context.Context, name string, value []byte) (string, error) {
+	result, err := p.client.AddSecretVersion(ctx, &secretmanagerpb.AddSecretVersionRequest{
+		Parent: "projects/" + p.projectId + "/secrets/" + name,
+		Payload: &secretmanagerpb.SecretPayload{
+			Data: value,
+		},
+	})
+	if err != nil {
+		return "", wrapError(err, fmt.Errorf("failed to add version to secret %s: %w", name, err))
+	}
+
+	return result.Name[strings.LastIndex(result.Name, "/")+1:], nil
+}
+
+func (p *GoogleProvider) DeleteSecret(ctx context.Context, name string) error {
+	err := p.client.DeleteSecret(ctx, &secretmanagerpb.DeleteSecretRequest{
+		Name: "projects/" + p.projectId + "/secrets/" + name,
+	})
+	if err != nil {
+		return wrapError(err, fmt.Errorf("failed to delete secret %s: %w", name, err))
+	}
+
+	return nil
+}
+
+// SetSecretTags replaces the labels of a secret with tags, which are mapped by toLabels
+func (p *GoogleProvider) SetSecretTags(ctx context.Context, name string, tags map[string]string) error {
+	_, err := p.client.UpdateSecret(ctx, &secretmanagerpb.UpdateSecretRequest{
+		Secret: &secretmanagerpb.Secret{
+			Name:   "projects/" + p.projectId + "/secrets/" + name,
+			Labels: toLabels(tags),
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels"}},
+	})
+	if err != nil {
+		return wrapError(err, fmt.Errorf("failed to set labels of secret %s: %w", name, err))
+	}
+
+	return nil
+}
+
+// maxLabelLength is the maximum length of label keys and values
+const maxLabelLength = 63
+
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// toLabels maps tags to valid labels: keys and values are lower-cased, invalid characters are replaced by "_"
+// and both are truncated to 63 characters. Tags whose key does not start with a letter are dropped.
+func toLabels(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(tags))
+	for k, v := range tags {
+		key := toLabel(k)
+		if key == "" || key[0] < 'a' || key[0] > 'z' {
+			log.Warnf("Dropping tag %s, which can't be mapped to a label", k)
+			continue
+		}
+		labels[key] = toLabel(v)
+	}
+
+	return labels
+}
+
+func toLabel(s string) string {
+	s = invalidLabelChars.ReplaceAllString(strings.ToLower(s), "_")
+	if len(s) > maxLabelLength {
+		s = s[:maxLabelLength]
+	}
+	return s
+}
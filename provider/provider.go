@@ -1,8 +1,140 @@
 package provider
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Secret is a single secret value fetched from a provider.
+type Secret struct {
+	// Name of the secret as it was requested from the provider
+	Name string
+	// Value is the raw secret payload
+	Value []byte
+	// Version identifies the revision of the secret that was fetched
+	Version string
+	// CreatedAt is the creation time of the version, zero if unknown
+	CreatedAt time.Time
+	// Metadata holds provider specific attributes of the secret (ARN, tags, etc.)
+	Metadata map[string]string
+}
+
 type Provider interface {
-	GetSecret(name string)
+	GetSecret(ctx context.Context, name string) (*Secret, error)
+}
+
+// VersionGetter is implemented by providers which are able to fetch a specific version of a secret.
+// The meaning of version is provider specific, e.g. a version number or alias.
+type VersionGetter interface {
+	GetSecretVersion(ctx context.Context, name string, version string) (*Secret, error)
+}
+
+// GetSecretVersion fetches the secret name from p in version, or in the default version of p if version is empty.
+func GetSecretVersion(ctx context.Context, p Provider, name string, version string) (*Secret, error) {
+	if version == "" {
+		return p.GetSecret(ctx, name)
+	}
+
+	getter, ok := p.(VersionGetter)
+	if !ok {
+		return nil, fmt.Errorf("provider does not support selecting the version of secret %s", name)
+	}
+	return getter.GetSecretVersion(ctx, name, version)
+}
+
+// SecretWriter is implemented by providers which are able to modify secrets.
+type SecretWriter interface {
+	// CreateSecret creates a secret with an initial version and returns the version.
+	// It returns an error wrapping ErrSecretExists if the secret already exists.
+	CreateSecret(ctx context.Context, name string, value []byte, tags map[string]string) (string, error)
+	// UpdateSecret adds a new version to an existing secret and returns the version.
+	UpdateSecret(ctx context.Context, name string, value []byte) (string, error)
+	// DeleteSecret deletes a secret with all its versions.
+	DeleteSecret(ctx context.Context, name string) error
+}
+
+// ErrSecretExists is returned by SecretWriter.CreateSecret if the secret already exists.
+var ErrSecretExists = errors.New("secret already exists")
+
+// TagGetter is implemented by providers which are able to return the tags (labels in GCP) of a secret.
+type TagGetter interface {
+	GetSecretTags(ctx context.Context, name string) (map[string]string, error)
+}
+
+// TagSetter is implemented by providers which are able to replace the tags (labels in GCP) of a secret.
+type TagSetter interface {
+	// SetSecretTags replaces all tags of an existing secret with tags.
+	SetSecretTags(ctx context.Context, name string, tags map[string]string) error
 }
 
 type BaseProvider struct {
-}
\ No newline at end of file
+}
+
+// Error is an error with a provider specific error code, e.g. ResourceNotFoundException.
+type Error struct {
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCode returns the provider specific code of err, or "unknown".
+func ErrorCode(err error) string {
+	var perr *Error
+	if errors.As(err, &perr) && perr.Code != "" {
+		return perr.Code
+	}
+	return "unknown"
+}
+
+// IsNotFound reports whether err is a provider error indicating that a secret does not exist.
+func IsNotFound(err error) bool {
+	switch ErrorCode(err) {
+	// AWS Secrets Manager, AWS SSM, GCP, Azure and Vault
+	case "ResourceNotFoundException", "ParameterNotFound", "NotFound", "404":
+		return true
+	}
+	return false
+}
+
+// IsPermissionDenied reports whether err is a provider error indicating that access to a secret was denied.
+func IsPermissionDenied(err error) bool {
+	switch ErrorCode(err) {
+	// AWS Secrets Manager and SSM, GCP, Azure and Vault
+	case "AccessDeniedException", "PermissionDenied", "403":
+		return true
+	}
+	return false
+}
+
+// KeyValues returns the secret as a set of key/value pairs.
+// Secrets holding a JSON object (e.g. AWS key/value secrets) are split into their keys,
+// non-string JSON values are kept in their JSON representation.
+// It returns false if the secret value is not a JSON object.
+func (s *Secret) KeyValues() (map[string]string, bool) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(s.Value, &raw); err != nil {
+		return nil, false
+	}
+
+	data := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var str string
+		if err := json.Unmarshal(v, &str); err == nil {
+			data[k] = str
+		} else {
+			data[k] = string(v)
+		}
+	}
+
+	return data, true
+}
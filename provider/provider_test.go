@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type staticProvider struct{}
+
+func (staticProvider) GetSecret(ctx context.Context, name string) (*Secret, error) {
+	return &Secret{Name: name, Value: []byte("latest")}, nil
+}
+
+type versionedProvider struct {
+	staticProvider
+}
+
+func (versionedProvider) GetSecretVersion(ctx context.Context, name string, version string) (*Secret, error) {
+	return &Secret{Name: name, Value: []byte(version), Version: version}, nil
+}
+
+func TestGetSecretVersion(t *testing.T) {
+	ctx := context.Background()
+
+	secret, err := GetSecretVersion(ctx, versionedProvider{}, "db", "")
+	if err != nil || string(secret.Value) != "latest" {
+		t.Errorf("secret = %+v, %v", secret, err)
+	}
+	secret, err = GetSecretVersion(ctx, versionedProvider{}, "db", "3")
+	if err != nil || secret.Version != "3" {
+		t.Errorf("secret = %+v, %v", secret, err)
+	}
+	if _, err := GetSecretVersion(ctx, staticProvider{}, "db", "3"); err == nil {
+		t.Error("expected an error for a provider without versions")
+	}
+}
+
+func TestIsPermissionDenied(t *testing.T) {
+	for code, want := range map[string]bool{
+		"AccessDeniedException":     true,
+		"PermissionDenied":          true,
+		"403":                       true,
+		"404":                       false,
+		"ResourceNotFoundException": false,
+	} {
+		if got := IsPermissionDenied(&Error{Code: code, Err: errors.New(code)}); got != want {
+			t.Errorf("IsPermissionDenied(%s) = %v, want %v", code, got, want)
+		}
+	}
+	if IsPermissionDenied(errors.New("denied")) {
+		t.Error("plain errors aren't provider errors")
+	}
+}
@@ -0,0 +1,34 @@
+package provider
+
+import (
+	"context"
+	"strings"
+)
+
+// Selector selects secrets by their tags (labels in GCP) and name.
+// All conditions must match; an empty selector matches every secret.
+type Selector struct {
+	// Tags the secret must have with exactly these values
+	Tags map[string]string
+	// NamePrefix the secret name must start with
+	NamePrefix string
+}
+
+// Matches reports whether a secret with the given name and tags is selected.
+func (s Selector) Matches(name string, tags map[string]string) bool {
+	if !strings.HasPrefix(name, s.NamePrefix) {
+		return false
+	}
+	for k, v := range s.Tags {
+		if value, ok := tags[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// SecretLister is implemented by providers which are able to discover secrets.
+type SecretLister interface {
+	// ListSecrets returns the names of all secrets matching selector
+	ListSecrets(ctx context.Context, selector Selector) ([]string, error)
+}
@@ -0,0 +1,292 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultKubernetesTokenPath is the service account token used for Kubernetes auth
+const DefaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+type VaultProvider struct {
+	provider.BaseProvider
+	client        *vault.Client
+	mountPath     string
+	kvVersion     int
+	secretVersion int
+
+	// config is kept to log in again once the token of the last login expires
+	config VaultConfig
+	// mu guards logins
+	mu sync.Mutex
+	// loginExpiry is the time a new login is due, zero if the token doesn't expire or isn't obtained by logging in
+	loginExpiry time.Time
+}
+
+type VaultConfig struct {
+	// Address of the Vault server, defaults to VAULT_ADDR
+	Address   string
+	Namespace string
+
+	// MountPath of the KV secrets engine, e.g. "secret"
+	MountPath string
+	// KVVersion of the secrets engine, 1 or 2
+	KVVersion int
+	// SecretVersion pins KV v2 secrets to a version, 0 selects the latest version
+	SecretVersion int
+
+	// AuthMethod is one of token, approle, kubernetes
+	AuthMethod string
+	// Token for the token auth method, defaults to VAULT_TOKEN
+	Token string
+	// AuthMountPath overrides the mount path of the approle or kubernetes auth method
+	AuthMountPath string
+	// RoleID and SecretID for the approle auth method
+	RoleID   string
+	SecretID string
+	// Role and TokenPath (the service account JWT) for the kubernetes auth method
+	Role      string
+	TokenPath string
+	// JWT returns the service account token of the kubernetes auth method, it takes precedence over TokenPath
+	JWT func() (string, error)
+}
+
+func NewVaultProvider(vaultConfig VaultConfig) (*VaultProvider, error) {
+	config := vault.DefaultConfig()
+	if config.Error != nil {
+		return nil, fmt.Errorf("failed to configure vault client: %w", config.Error)
+	}
+	if vaultConfig.Address != "" {
+		config.Address = vaultConfig.Address
+	}
+
+	client, err := vault.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup vault client: %w", err)
+	}
+	if vaultConfig.Namespace != "" {
+		client.SetNamespace(vaultConfig.Namespace)
+	}
+
+	if vaultConfig.KVVersion != 1 && vaultConfig.KVVersion != 2 {
+		return nil, fmt.Errorf("unsupported KV version: %d", vaultConfig.KVVersion)
+	}
+
+	provider := &VaultProvider{
+		client:        client,
+		mountPath:     strings.Trim(vaultConfig.MountPath, "/"),
+		kvVersion:     vaultConfig.KVVersion,
+		secretVersion: vaultConfig.SecretVersion,
+		config:        vaultConfig,
+	}
+	if err := provider.login(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+// login authenticates the client using the configured auth method. Tokens obtained by logging in
+// are replaced by a new login after three quarters of their TTL, or once Vault rejects them.
+// Tokens of the token auth method are used as they are.
+func (p *VaultProvider) login() error {
+	var (
+		path string
+		data map[string]interface{}
+	)
+
+	vaultConfig := p.config
+	client := p.client
+	switch vaultConfig.AuthMethod {
+	case "", "token":
+		if vaultConfig.Token != "" {
+			client.SetToken(vaultConfig.Token)
+		}
+		if client.Token() == "" {
+			return errors.New("no vault token specified")
+		}
+		return nil
+	case "approle":
+		path = authPath(vaultConfig.AuthMountPath, "approle")
+		data = map[string]interface{}{
+			"role_id":   vaultConfig.RoleID,
+			"secret_id": vaultConfig.SecretID,
+		}
+	case "kubernetes":
+		var jwt string
+		if vaultConfig.JWT != nil {
+			token, err := vaultConfig.JWT()
+			if err != nil {
+				return err
+			}
+			jwt = token
+		} else {
+			tokenPath := vaultConfig.TokenPath
+			if tokenPath == "" {
+				tokenPath = DefaultKubernetesTokenPath
+			}
+			token, err := os.ReadFile(tokenPath)
+			if err != nil {
+				return fmt.Errorf("failed to read service account token: %w", err)
+			}
+			jwt = string(token)
+		}
+
+		path = authPath(vaultConfig.AuthMountPath, "kubernetes")
+		data = map[string]interface{}{
+			"role": vaultConfig.Role,
+			"jwt":  strings.TrimSpace(jwt),
+		}
+	default:
+		return fmt.Errorf("unsupported vault auth method: %s", vaultConfig.AuthMethod)
+	}
+
+	log.Infof("Logging in to vault using %s", path)
+	secret, err := client.Logical().Write(path, data)
+	if err != nil {
+		return fmt.Errorf("vault login failed: %w", err)
+	}
+	if secret == nil || secret.Auth == nil {
+		return errors.New("vault login returned no token")
+	}
+	client.SetToken(secret.Auth.ClientToken)
+
+	p.loginExpiry = time.Time{}
+	if ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second; ttl > 0 {
+		p.loginExpiry = time.Now().Add(ttl * 3 / 4)
+	}
+
+	return nil
+}
+
+// canLogin reports whether the auth method obtains tokens by logging in
+func (p *VaultProvider) canLogin() bool {
+	return p.config.AuthMethod == "approle" || p.config.AuthMethod == "kubernetes"
+}
+
+// renewLogin logs in again if the token of the last login is about to expire
+func (p *VaultProvider) renewLogin() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.loginExpiry.IsZero() || time.Now().Before(p.loginExpiry) {
+		return nil
+	}
+	return p.login()
+}
+
+// relogin logs in again after Vault rejected token, if the token expired or was revoked.
+// It reports whether the request should be retried, which is not the case if the token is
+// still valid, i.e. the request was denied by a policy.
+func (p *VaultProvider) relogin(ctx context.Context, token string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Another request logged in already
+	if p.client.Token() != token {
+		return true, nil
+	}
+	if _, err := p.client.Auth().Token().LookupSelfWithContext(ctx); err == nil {
+		return false, nil
+	}
+	log.Infof("Vault token expired or was revoked, logging in again")
+	return true, p.login()
+}
+
+func authPath(mountPath string, method string) string {
+	if mountPath == "" {
+		mountPath = method
+	}
+	return "auth/" + strings.Trim(mountPath, "/") + "/login"
+}
+
+func (p *VaultProvider) GetSecret(ctx context.Context, name string) (*provider.Secret, error) {
+	name = strings.Trim(name, "/")
+
+	path := p.mountPath + "/" + name
+	var query map[string][]string
+	if p.kvVersion == 2 {
+		path = p.mountPath + "/data/" + name
+		if p.secretVersion > 0 {
+			query = map[string][]string{"version": {strconv.Itoa(p.secretVersion)}}
+		}
+	}
+
+	if err := p.renewLogin(); err != nil {
+		return nil, err
+	}
+	token := p.client.Token()
+	result, err := p.client.Logical().ReadWithDataWithContext(ctx, path, query)
+	if provider.ErrorCode(wrapError(err)) == strconv.Itoa(http.StatusForbidden) && p.canLogin() {
+		// The token may have been revoked or reached its maximum TTL
+		retry, loginErr := p.relogin(ctx, token)
+		if loginErr != nil {
+			return nil, loginErr
+		}
+		if retry {
+			result, err = p.client.Logical().ReadWithDataWithContext(ctx, path, query)
+		}
+	}
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("failed to get secret %s: %w", name, err))
+	}
+	if result == nil || result.Data == nil {
+		return nil, &provider.Error{Code: "404", Err: fmt.Errorf("secret %s not found", name)}
+	}
+
+	data := result.Data
+	secret := &provider.Secret{
+		Name: name,
+		Metadata: map[string]string{
+			"path": path,
+		},
+	}
+
+	if p.kvVersion == 2 {
+		// KV v2 wraps the secret data together with its metadata
+		inner, ok := result.Data["data"].(map[string]interface{})
+		if !ok {
+			// The data is null if the version was deleted
+			return nil, &provider.Error{Code: "404", Err: fmt.Errorf("secret %s has no data", name)}
+		}
+		data = inner
+
+		if metadata, ok := result.Data["metadata"].(map[string]interface{}); ok {
+			if version, ok := metadata["version"].(json.Number); ok {
+				secret.Version = version.String()
+			}
+			if created, ok := metadata["created_time"].(string); ok {
+				secret.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+			}
+		}
+	}
+
+	value, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	secret.Value = value
+
+	return secret, nil
+}
+
+// wrapError attaches the HTTP status code of vault errors to err
+func wrapError(err error) error {
+	var rerr *vault.ResponseError
+	if errors.As(err, &rerr) {
+		return &provider.Error{Code: strconv.Itoa(rerr.StatusCode), Err: err}
+	}
+	return err
+}
@@ -0,0 +1,365 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+// fakeVault serves KV reads and auth logins of a Vault server
+type fakeVault struct {
+	t *testing.T
+	// token accepted for reads, issued by logins
+	token string
+	// responses of GET requests by path
+	secrets map[string]interface{}
+	// bodies of the login requests by path
+	logins map[string]map[string]interface{}
+	// paths the token is denied access to by policy
+	denied map[string]bool
+	// queries of the GET requests
+	queries []string
+	// loginCount counts the logins
+	loginCount int
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	return &fakeVault{
+		t:     t,
+		token: "s.client",
+		secrets: map[string]interface{}{
+			"/v1/auth/token/lookup-self": map[string]interface{}{"ttl": 3600},
+		},
+		logins: map[string]map[string]interface{}{},
+		denied: map[string]bool{},
+	}
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			f.t.Errorf("failed to decode login request: %v", err)
+		}
+		f.logins[r.URL.Path] = body
+		f.loginCount++
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": f.token, "lease_duration": 3600, "renewable": true},
+		})
+	case http.MethodGet:
+		if r.Header.Get("X-Vault-Token") != f.token || f.denied[r.URL.Path] {
+			writeJSON(w, http.StatusForbidden, map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		f.queries = append(f.queries, r.URL.RawQuery)
+		secret, ok := f.secrets[r.URL.Path]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"errors": []string{}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": secret})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestProvider(t *testing.T, f *fakeVault, config VaultConfig) *VaultProvider {
+	t.Helper()
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	t.Setenv("VAULT_TOKEN", "")
+	config.Address = server.URL
+	p, err := NewVaultProvider(config)
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	return p
+}
+
+func TestGetSecretKVv1(t *testing.T) {
+	f := newFakeVault(t)
+	f.secrets["/v1/kv/prod/db"] = map[string]interface{}{"password": "hunter2"}
+	p := newTestProvider(t, f, VaultConfig{MountPath: "/kv/", KVVersion: 1, Token: f.token})
+
+	secret, err := p.GetSecret(context.Background(), "/prod/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(secret.Value); got != `{"password":"hunter2"}` {
+		t.Errorf("value = %s", got)
+	}
+	if secret.Version != "" {
+		t.Errorf("KV v1 secrets have no version, got %q", secret.Version)
+	}
+	if secret.Metadata["path"] != "kv/prod/db" {
+		t.Errorf("path = %q", secret.Metadata["path"])
+	}
+}
+
+func TestGetSecretKVv2(t *testing.T) {
+	f := newFakeVault(t)
+	f.secrets["/v1/secret/data/db"] = map[string]interface{}{
+		"data": map[string]interface{}{"password": "hunter2"},
+		"metadata": map[string]interface{}{
+			"version":      4,
+			"created_time": "2024-01-02T03:04:05.123456Z",
+		},
+	}
+	p := newTestProvider(t, f, VaultConfig{MountPath: "secret", KVVersion: 2, Token: f.token})
+
+	secret, err := p.GetSecret(context.Background(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(secret.Value); got != `{"password":"hunter2"}` {
+		t.Errorf("value = %s", got)
+	}
+	if secret.Version != "4" {
+		t.Errorf("version = %q", secret.Version)
+	}
+	if secret.CreatedAt.IsZero() || secret.CreatedAt.Year() != 2024 {
+		t.Errorf("created at = %v", secret.CreatedAt)
+	}
+	if f.queries[0] != "" {
+		t.Errorf("unpinned read sent query %q", f.queries[0])
+	}
+}
+
+func TestGetSecretKVv2PinnedVersion(t *testing.T) {
+	f := newFakeVault(t)
+	f.secrets["/v1/secret/data/db"] = map[string]interface{}{
+		"data":     map[string]interface{}{"password": "old"},
+		"metadata": map[string]interface{}{"version": 2},
+	}
+	p := newTestProvider(t, f, VaultConfig{MountPath: "secret", KVVersion: 2, SecretVersion: 2, Token: f.token})
+
+	secret, err := p.GetSecret(context.Background(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.queries[0] != "version=2" {
+		t.Errorf("query = %q, want version=2", f.queries[0])
+	}
+	if secret.Version != "2" {
+		t.Errorf("version = %q", secret.Version)
+	}
+}
+
+func TestGetSecretKVv2DeletedVersion(t *testing.T) {
+	f := newFakeVault(t)
+	f.secrets["/v1/secret/data/db"] = map[string]interface{}{
+		"data":     nil,
+		"metadata": map[string]interface{}{"version": 3, "deletion_time": "2024-01-02T03:04:05Z"},
+	}
+	p := newTestProvider(t, f, VaultConfig{MountPath: "secret", KVVersion: 2, Token: f.token})
+
+	if _, err := p.GetSecret(context.Background(), "db"); !provider.IsNotFound(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestGetSecretErrors(t *testing.T) {
+	f := newFakeVault(t)
+	p := newTestProvider(t, f, VaultConfig{MountPath: "secret", KVVersion: 1, Token: f.token})
+
+	if _, err := p.GetSecret(context.Background(), "missing"); !provider.IsNotFound(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	p.client.SetToken("s.expired")
+	_, err := p.GetSecret(context.Background(), "missing")
+	perr, ok := err.(*provider.Error)
+	if !ok || perr.Code != "403" {
+		t.Errorf("expected error with code 403, got %v", err)
+	}
+}
+
+func TestLoginToken(t *testing.T) {
+	f := newFakeVault(t)
+	p := newTestProvider(t, f, VaultConfig{MountPath: "secret", KVVersion: 1, Token: f.token})
+
+	if p.client.Token() != f.token {
+		t.Errorf("token = %q", p.client.Token())
+	}
+	if len(f.logins) != 0 {
+		t.Errorf("token auth logged in: %v", f.logins)
+	}
+}
+
+func TestLoginTokenMissing(t *testing.T) {
+	server := httptest.NewServer(newFakeVault(t))
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "")
+
+	_, err := NewVaultProvider(VaultConfig{Address: server.URL, MountPath: "secret", KVVersion: 1})
+	if err == nil {
+		t.Fatal("expected error without token")
+	}
+}
+
+func TestLoginAppRole(t *testing.T) {
+	f := newFakeVault(t)
+	p := newTestProvider(t, f, VaultConfig{
+		MountPath:     "secret",
+		KVVersion:     1,
+		AuthMethod:    "approle",
+		AuthMountPath: "/ci-approle/",
+		RoleID:        "role-id",
+		SecretID:      "secret-id",
+	})
+
+	login, ok := f.logins["/v1/auth/ci-approle/login"]
+	if !ok {
+		t.Fatalf("no approle login, got %v", f.logins)
+	}
+	if login["role_id"] != "role-id" || login["secret_id"] != "secret-id" {
+		t.Errorf("login = %v", login)
+	}
+	if p.client.Token() != f.token {
+		t.Errorf("token = %q", p.client.Token())
+	}
+}
+
+func TestLoginKubernetes(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("service-account-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFakeVault(t)
+	p := newTestProvider(t, f, VaultConfig{
+		MountPath:  "secret",
+		KVVersion:  1,
+		AuthMethod: "kubernetes",
+		Role:       "app",
+		TokenPath:  tokenPath,
+	})
+
+	login, ok := f.logins["/v1/auth/kubernetes/login"]
+	if !ok {
+		t.Fatalf("no kubernetes login, got %v", f.logins)
+	}
+	if login["role"] != "app" || login["jwt"] != "service-account-jwt" {
+		t.Errorf("login = %v", login)
+	}
+	if p.client.Token() != f.token {
+		t.Errorf("token = %q", p.client.Token())
+	}
+}
+
+func TestLoginKubernetesJWT(t *testing.T) {
+	f := newFakeVault(t)
+	newTestProvider(t, f, VaultConfig{
+		MountPath:  "secret",
+		KVVersion:  1,
+		AuthMethod: "kubernetes",
+		Role:       "app",
+		JWT:        func() (string, error) { return "inline-jwt", nil },
+		TokenPath:  "/nonexistent",
+	})
+
+	if login := f.logins["/v1/auth/kubernetes/login"]; login["jwt"] != "inline-jwt" {
+		t.Errorf("login = %v", login)
+	}
+}
+
+func TestReloginRejectedToken(t *testing.T) {
+	f := newFakeVault(t)
+	f.secrets["/v1/secret/db"] = map[string]interface{}{"password": "hunter2"}
+	p := newTestProvider(t, f, VaultConfig{MountPath: "secret", KVVersion: 1, AuthMethod: "approle", RoleID: "role-id", SecretID: "secret-id"})
+
+	// The token was revoked, e.g. as it reached its maximum TTL
+	f.token = "s.new"
+	if _, err := p.GetSecret(context.Background(), "db"); err != nil {
+		t.Fatal(err)
+	}
+	if f.loginCount != 2 {
+		t.Errorf("logins = %d, want 2", f.loginCount)
+	}
+	if p.client.Token() != "s.new" {
+		t.Errorf("token = %q", p.client.Token())
+	}
+}
+
+func TestReloginExpiredToken(t *testing.T) {
+	f := newFakeVault(t)
+	f.secrets["/v1/secret/db"] = map[string]interface{}{"password": "hunter2"}
+	jwts := 0
+	p := newTestProvider(t, f, VaultConfig{
+		MountPath:  "secret",
+		KVVersion:  1,
+		AuthMethod: "kubernetes",
+		Role:       "app",
+		JWT: func() (string, error) {
+			jwts++
+			return "jwt-" + strconv.Itoa(jwts), nil
+		},
+	})
+	if p.loginExpiry.IsZero() || time.Until(p.loginExpiry) > time.Hour {
+		t.Fatalf("login expiry = %v, want 45m", p.loginExpiry)
+	}
+
+	if _, err := p.GetSecret(context.Background(), "db"); err != nil {
+		t.Fatal(err)
+	}
+	if f.loginCount != 1 {
+		t.Errorf("logged in again before the token expired: %d logins", f.loginCount)
+	}
+
+	p.loginExpiry = time.Now().Add(-time.Second)
+	if _, err := p.GetSecret(context.Background(), "db"); err != nil {
+		t.Fatal(err)
+	}
+	if f.loginCount != 2 {
+		t.Errorf("logins = %d, want 2", f.loginCount)
+	}
+	if login := f.logins["/v1/auth/kubernetes/login"]; login["jwt"] != "jwt-2" {
+		t.Errorf("login didn't request a new service account token: %v", login)
+	}
+}
+
+func TestTokenAuthDoesntRelogin(t *testing.T) {
+	f := newFakeVault(t)
+	p := newTestProvider(t, f, VaultConfig{MountPath: "secret", KVVersion: 1, Token: f.token})
+
+	f.token = "s.new"
+	_, err := p.GetSecret(context.Background(), "db")
+	if provider.ErrorCode(err) != "403" {
+		t.Errorf("expected error with code 403, got %v", err)
+	}
+	if f.loginCount != 0 {
+		t.Errorf("token auth logged in %d times", f.loginCount)
+	}
+}
+
+func TestPolicyDenialDoesntRelogin(t *testing.T) {
+	f := newFakeVault(t)
+	f.denied["/v1/secret/db"] = true
+	p := newTestProvider(t, f, VaultConfig{MountPath: "secret", KVVersion: 1, AuthMethod: "approle", RoleID: "role-id", SecretID: "secret-id"})
+
+	for i := 0; i < 2; i++ {
+		_, err := p.GetSecret(context.Background(), "db")
+		if provider.ErrorCode(err) != "403" {
+			t.Errorf("expected error with code 403, got %v", err)
+		}
+	}
+	if f.loginCount != 1 {
+		t.Errorf("logged in again although the token is valid: %d logins", f.loginCount)
+	}
+}
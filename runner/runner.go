@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// forwardedSignals are passed on to the child process
+var forwardedSignals = []os.Signal{
+	syscall.SIGTERM,
+	syscall.SIGINT,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// Run starts command with the given environment and waits for it to exit.
+// Signals received in the meantime are forwarded to the child.
+// It returns the exit code of the child, shells' convention of 128+n is used
+// if the child was terminated by signal n.
+func Run(command []string, environ []string) (int, error) {
+	if len(command) == 0 {
+		return 0, errors.New("no command specified")
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = environ
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", command[0], err)
+	}
+	log.Debugf("Started %s (pid: %d)", command[0], cmd.Process.Pid)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				log.Debugf("Forwarding %s to %s", sig, command[0])
+				if err := cmd.Process.Signal(sig); err != nil {
+					log.Warnf("failed to forward %s: %v", sig, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 0, err
+		}
+	}
+
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+
+	return cmd.ProcessState.ExitCode(), nil
+}
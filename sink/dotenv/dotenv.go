@@ -0,0 +1,103 @@
+package dotenv
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/sink"
+	log "github.com/sirupsen/logrus"
+)
+
+type DotenvSink struct {
+	path     string
+	fileMode os.FileMode
+	uid      int
+	gid      int
+}
+
+type DotenvConfig struct {
+	Path     string
+	FileMode string
+	Owner    string
+}
+
+func NewDotenvSink(dotenvConfig DotenvConfig) (*DotenvSink, error) {
+	fileMode, err := sink.ParseFileMode(dotenvConfig.FileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, gid, err := sink.ParseOwner(dotenvConfig.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &DotenvSink{
+		path:     dotenvConfig.Path,
+		fileMode: fileMode,
+		uid:      uid,
+		gid:      gid,
+	}
+
+	return s, nil
+}
+
+func (s *DotenvSink) Write(ctx context.Context, secrets []*provider.Secret) error {
+	data := Render(secrets)
+	if err := sink.WriteFile(s.path, data, s.fileMode, s.uid, s.gid); err != nil {
+		return err
+	}
+	log.Infof("Wrote %d secret(s) to %s", len(secrets), s.path)
+
+	return nil
+}
+
+func (s *DotenvSink) UpToDate(ctx context.Context, secrets []*provider.Secret) (bool, error) {
+	return sink.FileUpToDate(s.path, Render(secrets))
+}
+
+// Render renders secrets in dotenv format.
+// JSON object secrets are expanded into one variable per key, any other secret
+// becomes a single variable named after the secret. Later secrets override earlier ones.
+func Render(secrets []*provider.Secret) []byte {
+	vars := map[string]string{}
+	for _, secret := range secrets {
+		for k, v := range sink.EnvVars(secret) {
+			vars[k] = v
+		}
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		buf.WriteString(k)
+		buf.WriteString("=")
+		buf.WriteString(quote(vars[k]))
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes()
+}
+
+var quoteReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`$`, `\$`,
+	"`", "\\`",
+	"\n", `\n`,
+	"\r", `\r`,
+)
+
+// quote returns value as a double quoted dotenv value
+func quote(value string) string {
+	return `"` + quoteReplacer.Replace(value) + `"`
+}
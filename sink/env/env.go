@@ -0,0 +1,56 @@
+package env
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/sink"
+)
+
+// EnvSink keeps fetched secrets in memory as environment variables,
+// e.g. to pass them to a child process.
+type EnvSink struct {
+	vars    map[string]string
+	varsMux sync.Mutex
+}
+
+func NewEnvSink() *EnvSink {
+	return &EnvSink{
+		vars: map[string]string{},
+	}
+}
+
+func (s *EnvSink) Write(ctx context.Context, secrets []*provider.Secret) error {
+	s.varsMux.Lock()
+	defer s.varsMux.Unlock()
+	for _, secret := range secrets {
+		for k, v := range sink.EnvVars(secret) {
+			s.vars[k] = v
+		}
+	}
+
+	return nil
+}
+
+// Environ returns base extended with the collected variables in "key=value" form.
+// Collected variables take precedence over variables in base.
+func (s *EnvSink) Environ(base []string) []string {
+	s.varsMux.Lock()
+	defer s.varsMux.Unlock()
+
+	keys := make([]string, 0, len(s.vars))
+	for k := range s.vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// os/exec keeps the last value of duplicate keys
+	environ := append([]string{}, base...)
+	for _, k := range keys {
+		environ = append(environ, k+"="+s.vars[k])
+	}
+
+	return environ
+}
@@ -0,0 +1,286 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// FieldManager owns the fields of the Secrets applied by the sink
+	FieldManager = "cloud-secrets"
+
+	// Annotations recording the source of a Secret
+	AnnotationProvider = "cloud-secrets.kvendingoldo.io/provider"
+	AnnotationSecret   = "cloud-secrets.kvendingoldo.io/secret"
+	AnnotationVersion  = "cloud-secrets.kvendingoldo.io/version"
+
+	// inClusterNamespacePath holds the namespace of the pod when running in a cluster
+	inClusterNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// KubernetesSink writes every secret into a Kubernetes Secret using server-side apply,
+// so Secrets are created or updated and fields managed by others are kept.
+// Secrets holding a JSON object get one data key per object key, other secrets a single data key.
+// Object keys invalid in Secret data are mapped by DataKey.
+// Secret names are derived from the secret names by SecretName, different secrets mapping to the same Secret are an error.
+// Secrets are never deleted, even if the cloud secret no longer is synchronized.
+type KubernetesSink struct {
+	client     clientset.Interface
+	namespace  string
+	namePrefix string
+	secretType corev1.SecretType
+	labels     map[string]string
+	key        string
+	provider   string
+}
+
+type KubernetesConfig struct {
+	// Client to use (optional), e.g. a fake clientset; otherwise created from Kubeconfig
+	Client clientset.Interface
+	// Kubeconfig is the path of a kubeconfig file, the in-cluster config is used if empty
+	Kubeconfig string
+
+	// Namespace of the Secrets, defaults to the namespace of the pod
+	Namespace string
+	// NamePrefix is prepended to the Secret names, which are derived from the secret names (or aliases)
+	NamePrefix string
+	// Type of the Secrets (default: Opaque)
+	Type string
+	// Labels set on the Secrets
+	Labels map[string]string
+	// Key is the data key of secrets which are not JSON objects (default: value)
+	Key string
+
+	// Provider is recorded in the annotations of the Secrets
+	Provider string
+}
+
+func NewKubernetesSink(kubernetesConfig KubernetesConfig) (*KubernetesSink, error) {
+	client := kubernetesConfig.Client
+	if client == nil {
+		config, err := clientcmd.BuildConfigFromFlags("", kubernetesConfig.Kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+		}
+		client, err = clientset.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup kubernetes client: %w", err)
+		}
+	}
+
+	namespace := kubernetesConfig.Namespace
+	if namespace == "" {
+		data, err := os.ReadFile(inClusterNamespacePath)
+		if err != nil {
+			return nil, fmt.Errorf("no kubernetes namespace specified: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	secretType := corev1.SecretTypeOpaque
+	if kubernetesConfig.Type != "" {
+		secretType = corev1.SecretType(kubernetesConfig.Type)
+	}
+
+	key := kubernetesConfig.Key
+	if key == "" {
+		key = "value"
+	}
+
+	s := &KubernetesSink{
+		client:     client,
+		namespace:  namespace,
+		namePrefix: kubernetesConfig.NamePrefix,
+		secretType: secretType,
+		labels:     kubernetesConfig.Labels,
+		key:        key,
+		provider:   kubernetesConfig.Provider,
+	}
+
+	return s, nil
+}
+
+func (s *KubernetesSink) Write(ctx context.Context, secrets []*provider.Secret) error {
+	names, err := s.secretNames(secrets)
+	if err != nil {
+		return err
+	}
+	for i, secret := range secrets {
+		if err := s.apply(ctx, names[i], secret); err != nil {
+			return err
+		}
+	}
+	log.Infof("Applied %d secret(s) to namespace %s", len(secrets), s.namespace)
+
+	return nil
+}
+
+func (s *KubernetesSink) UpToDate(ctx context.Context, secrets []*provider.Secret) (bool, error) {
+	names, err := s.secretNames(secrets)
+	if err != nil {
+		return false, err
+	}
+	for i, secret := range secrets {
+		name := names[i]
+		data, err := s.data(secret)
+		if err != nil {
+			return false, err
+		}
+
+		current, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get secret %s/%s: %w", s.namespace, name, err)
+		}
+		if current.Annotations[AnnotationVersion] != secret.Version {
+			return false, nil
+		}
+		// Keys added by other field managers are kept by apply, so they are ignored
+		for k, v := range data {
+			if !bytes.Equal(current.Data[k], v) {
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// secretNames returns the names of the Kubernetes Secrets of secrets.
+// It returns an error if a name is invalid or different secrets map to the same Secret.
+func (s *KubernetesSink) secretNames(secrets []*provider.Secret) ([]string, error) {
+	names := make([]string, len(secrets))
+	sources := make(map[string]string, len(secrets))
+	for i, secret := range secrets {
+		name, err := SecretName(secret.Name)
+		if err != nil {
+			return nil, err
+		}
+		name = s.namePrefix + name
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid name %s of secret %s: %s", name, secret.Name, strings.Join(errs, ", "))
+		}
+		if other, ok := sources[name]; ok {
+			return nil, fmt.Errorf("secrets %s and %s both map to secret %s/%s", other, secret.Name, s.namespace, name)
+		}
+		sources[name] = secret.Name
+		names[i] = name
+	}
+	return names, nil
+}
+
+// apply creates or updates the Kubernetes Secret name of secret
+func (s *KubernetesSink) apply(ctx context.Context, name string, secret *provider.Secret) error {
+	labels := map[string]string{
+		"app.kubernetes.io/managed-by": FieldManager,
+	}
+	for k, v := range s.labels {
+		labels[k] = v
+	}
+
+	data, err := s.data(secret)
+	if err != nil {
+		return err
+	}
+
+	config := corev1apply.Secret(name, s.namespace).
+		WithType(s.secretType).
+		WithLabels(labels).
+		WithAnnotations(map[string]string{
+			AnnotationProvider: s.provider,
+			AnnotationSecret:   secret.Name,
+			AnnotationVersion:  secret.Version,
+		}).
+		WithData(data)
+
+	_, err = s.client.CoreV1().Secrets(s.namespace).Apply(ctx, config, metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply secret %s/%s: %w", s.namespace, name, err)
+	}
+	log.Debugf("Applied secret %s/%s (version: %s)", s.namespace, name, secret.Version)
+
+	return nil
+}
+
+// data returns the Secret data of secret
+func (s *KubernetesSink) data(secret *provider.Secret) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	if kv, ok := secret.KeyValues(); ok {
+		if err := AddKeyValues(data, secret.Name, kv); err != nil {
+			return nil, err
+		}
+	} else {
+		data[s.key] = secret.Value
+	}
+	return data, nil
+}
+
+// maxDataKeyLength is the maximum length of keys of Secret data
+const maxDataKeyLength = 253
+
+var invalidDataKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+
+// DataKey maps a name to a valid key of Secret data, e.g. "db/password" becomes "db_password".
+// It returns an error for names which can't be mapped, e.g. "." or names longer than 253 characters.
+func DataKey(name string) (string, error) {
+	key := invalidDataKeyChars.ReplaceAllString(name, "_")
+	if key == "" || key == "." || key == ".." || len(key) > maxDataKeyLength {
+		return "", fmt.Errorf("%q can't be mapped to a key of secret data", name)
+	}
+	return key, nil
+}
+
+// AddKeyValues adds the key/value pairs of a secret to data, the keys are mapped by DataKey.
+// It returns an error if a key can't be mapped or different keys map to the same data key.
+func AddKeyValues(data map[string][]byte, secret string, kv map[string]string) error {
+	keys := make(map[string]string, len(kv))
+	for k, v := range kv {
+		key, err := DataKey(k)
+		if err != nil {
+			return fmt.Errorf("invalid key of secret %s: %w", secret, err)
+		}
+		if other, ok := keys[key]; ok {
+			return fmt.Errorf("keys %q and %q of secret %s both map to data key %s", other, k, secret, key)
+		}
+		keys[key] = k
+		data[key] = []byte(v)
+	}
+	return nil
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// SecretName maps a secret name to a valid Kubernetes object name,
+// e.g. "prod/DB_PASSWORD" becomes "prod-db-password".
+// It returns an error for names which can't be mapped, e.g. names without any letter or digit.
+func SecretName(name string) (string, error) {
+	mapped := strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	mapped = invalidNameChars.ReplaceAllString(mapped, "-")
+	if len(mapped) > 253 {
+		mapped = mapped[:253]
+	}
+	mapped = strings.Trim(mapped, "-.")
+	if errs := validation.IsDNS1123Subdomain(mapped); len(errs) > 0 {
+		return "", fmt.Errorf("%q can't be mapped to a secret name: %s", name, strings.Join(errs, ", "))
+	}
+	return mapped, nil
+}
@@ -0,0 +1,205 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestSink(t *testing.T) (*KubernetesSink, *fake.Clientset) {
+	t.Helper()
+	client := fake.NewClientset()
+	s, err := NewKubernetesSink(KubernetesConfig{
+		Client:     client,
+		Namespace:  "apps",
+		NamePrefix: "cs-",
+		Labels:     map[string]string{"team": "a"},
+		Provider:   "aws",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+func TestWrite(t *testing.T) {
+	s, client := newTestSink(t)
+
+	err := s.Write(context.Background(), []*provider.Secret{
+		{Name: "prod/DB_PASSWORD", Value: []byte("hunter2"), Version: "1"},
+		{Name: "prod/api", Value: []byte(`{"key":"k","db/password":"p","with space":"s","port":5432}`), Version: "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := client.CoreV1().Secrets("apps").Get(context.Background(), "cs-prod-db-password", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(db.Data["value"]); got != "hunter2" {
+		t.Errorf("value = %q", got)
+	}
+	if db.Labels["team"] != "a" || db.Labels["app.kubernetes.io/managed-by"] != FieldManager {
+		t.Errorf("labels = %v", db.Labels)
+	}
+	if db.Annotations[AnnotationSecret] != "prod/DB_PASSWORD" || db.Annotations[AnnotationVersion] != "1" || db.Annotations[AnnotationProvider] != "aws" {
+		t.Errorf("annotations = %v", db.Annotations)
+	}
+
+	api, err := client.CoreV1().Secrets("apps").Get(context.Background(), "cs-prod-api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"key": "k", "db_password": "p", "with_space": "s", "port": "5432"}
+	got := map[string]string{}
+	for k, v := range api.Data {
+		got[k] = string(v)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("data = %v, want %v", got, want)
+	}
+}
+
+func TestWriteUpdatesSecret(t *testing.T) {
+	s, client := newTestSink(t)
+
+	for _, value := range []string{"old", "new"} {
+		if err := s.Write(context.Background(), []*provider.Secret{{Name: "db", Value: []byte(value)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := client.CoreV1().Secrets("apps").Get(context.Background(), "cs-db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(db.Data["value"]); got != "new" {
+		t.Errorf("value = %q", got)
+	}
+}
+
+func TestWriteRejectsCollidingKeys(t *testing.T) {
+	s, _ := newTestSink(t)
+
+	err := s.Write(context.Background(), []*provider.Secret{
+		{Name: "db", Value: []byte(`{"db/password":"a","db password":"b"}`)},
+	})
+	if err == nil || !strings.Contains(err.Error(), "both map to data key db_password") {
+		t.Errorf("expected collision error, got %v", err)
+	}
+}
+
+func TestDataKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "password", want: "password"},
+		{name: "DB_PASSWORD.v-1", want: "DB_PASSWORD.v-1"},
+		{name: "/prod/db/password", want: "_prod_db_password"},
+		{name: "with  spaces", want: "with_spaces"},
+		{name: "ünïcode", want: "_n_code"},
+		{name: "", wantErr: true},
+		{name: ".", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: strings.Repeat("a", 254), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := DataKey(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DataKey(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("DataKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSecretName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "prod/DB_PASSWORD", want: "prod-db-password"},
+		{name: "/prod/db/", want: "prod-db"},
+		{name: "a b.c", want: "a-b.c"},
+		{name: "a b..c", wantErr: true},
+		{name: "/_/", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := SecretName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SecretName(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("SecretName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteNameCollision(t *testing.T) {
+	s, client := newTestSink(t)
+
+	err := s.Write(context.Background(), []*provider.Secret{
+		{Name: "prod/db", Value: []byte("a")},
+		{Name: "prod_DB", Value: []byte("b")},
+	})
+	if err == nil || !strings.Contains(err.Error(), "both map to secret apps/cs-prod-db") {
+		t.Errorf("expected collision error, got %v", err)
+	}
+
+	secrets, err := client.CoreV1().Secrets("apps").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) != 0 {
+		t.Errorf("applied %d secret(s) despite the collision", len(secrets.Items))
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	s, client := newTestSink(t)
+	ctx := context.Background()
+	secrets := []*provider.Secret{{Name: "db", Value: []byte("hunter2"), Version: "1"}}
+
+	if ok, err := s.UpToDate(ctx, secrets); err != nil || ok {
+		t.Errorf("missing secret is up to date: %v, %v", ok, err)
+	}
+	if err := s.Write(ctx, secrets); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.UpToDate(ctx, secrets); err != nil || !ok {
+		t.Errorf("written secret isn't up to date: %v, %v", ok, err)
+	}
+
+	db, err := client.CoreV1().Secrets("apps").Get(ctx, "cs-db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Data["value"] = []byte("modified")
+	if _, err := client.CoreV1().Secrets("apps").Update(ctx, db, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.UpToDate(ctx, secrets); err != nil || ok {
+		t.Errorf("modified secret is up to date: %v, %v", ok, err)
+	}
+
+	if err := s.Write(ctx, secrets); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CoreV1().Secrets("apps").Delete(ctx, "cs-db", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.UpToDate(ctx, secrets); err != nil || ok {
+		t.Errorf("deleted secret is up to date: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+)
+
+// Sink is a destination for fetched secrets.
+type Sink interface {
+	Write(ctx context.Context, secrets []*provider.Secret) error
+}
+
+// Checker is implemented by sinks which can tell whether their output is up to date,
+// so outputs which were deleted or modified since they were written are restored.
+type Checker interface {
+	// UpToDate reports whether the output for secrets exists and matches what Write would write
+	UpToDate(ctx context.Context, secrets []*provider.Secret) (bool, error)
+}
+
+// ParseFileMode parses an octal file mode such as "0600".
+func ParseFileMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q: %w", mode, err)
+	}
+	return os.FileMode(m).Perm(), nil
+}
+
+// ParseOwner parses an owner in the form "user[:group]", where user and group
+// may be names or numeric ids. Unset parts are returned as -1.
+func ParseOwner(owner string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner == "" {
+		return uid, gid, nil
+	}
+
+	userPart, groupPart, _ := strings.Cut(owner, ":")
+	if userPart != "" {
+		id, err := strconv.Atoi(userPart)
+		if err != nil {
+			u, err := user.Lookup(userPart)
+			if err != nil {
+				return uid, gid, fmt.Errorf("unknown user %s: %w", userPart, err)
+			}
+			id, _ = strconv.Atoi(u.Uid)
+		}
+		uid = id
+	}
+	if groupPart != "" {
+		id, err := strconv.Atoi(groupPart)
+		if err != nil {
+			g, err := user.LookupGroup(groupPart)
+			if err != nil {
+				return uid, gid, fmt.Errorf("unknown group %s: %w", groupPart, err)
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		gid = id
+	}
+
+	return uid, gid, nil
+}
+
+// WriteFile atomically replaces the file at path with data.
+// The content is written to a temporary file in the same directory which is then renamed,
+// so readers never observe a partially written file.
+func WriteFile(path string, data []byte, perm os.FileMode, uid, gid int) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	// Cleanup is a no-op once the file has been renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if uid != -1 || gid != -1 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// FileUpToDate reports whether the file at path exists with the given content.
+func FileUpToDate(path string, data []byte) (bool, error) {
+	current, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(current, data), nil
+}
+
+// EnvVars converts a secret to environment variables.
+func EnvVars(secret *provider.Secret) map[string]string {
+	vars := map[string]string{}
+	if data, ok := secret.KeyValues(); ok {
+		for k, v := range data {
+			vars[EnvKey(k)] = v
+		}
+	} else {
+		vars[EnvKey(secret.Name)] = string(secret.Value)
+	}
+
+	return vars
+}
+
+// EnvKey converts name to a valid environment variable name,
+// e.g. "db/password" becomes "DB_PASSWORD".
+func EnvKey(name string) string {
+	key := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		key = "_" + key
+	}
+
+	return key
+}
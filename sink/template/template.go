@@ -0,0 +1,193 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/sink"
+	log "github.com/sirupsen/logrus"
+)
+
+type TemplateSink struct {
+	templates []*fileTemplate
+	fileMode  os.FileMode
+	uid       int
+	gid       int
+}
+
+type TemplateConfig struct {
+	// Templates in the form "source:destination"
+	Templates []string
+	FileMode  string
+	Owner     string
+}
+
+// fileTemplate is a parsed template together with its output path
+type fileTemplate struct {
+	tmpl        *template.Template
+	source      string
+	destination string
+}
+
+// templateData is the data templates are executed with
+type templateData struct {
+	// Secrets by name (or alias), e.g. {{ .Secrets.db.Version }}
+	Secrets map[string]*provider.Secret
+}
+
+func NewTemplateSink(templateConfig TemplateConfig) (*TemplateSink, error) {
+	fileMode, err := sink.ParseFileMode(templateConfig.FileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, gid, err := sink.ParseOwner(templateConfig.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TemplateSink{
+		fileMode: fileMode,
+		uid:      uid,
+		gid:      gid,
+	}
+
+	for _, t := range templateConfig.Templates {
+		source, destination, ok := strings.Cut(t, ":")
+		if !ok || source == "" || destination == "" {
+			return nil, fmt.Errorf("invalid template %q, expected source:destination", t)
+		}
+
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+
+		// The functions are rebound to the actual secrets on each render
+		tmpl, err := template.New(filepath.Base(source)).
+			Option("missingkey=error").
+			Funcs(funcMap(nil)).
+			Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", source, err)
+		}
+
+		s.templates = append(s.templates, &fileTemplate{
+			tmpl:        tmpl,
+			source:      source,
+			destination: destination,
+		})
+	}
+
+	return s, nil
+}
+
+func (s *TemplateSink) Write(ctx context.Context, secrets []*provider.Secret) error {
+	for _, t := range s.templates {
+		data, err := Render(t.tmpl, secrets)
+		if err != nil {
+			return fmt.Errorf("failed to render template %s: %w", t.source, err)
+		}
+
+		if ok, err := sink.FileUpToDate(t.destination, data); err == nil && ok {
+			log.Debugf("Template %s is up to date", t.destination)
+			continue
+		}
+
+		if err := sink.WriteFile(t.destination, data, s.fileMode, s.uid, s.gid); err != nil {
+			return err
+		}
+		log.Infof("Rendered template %s to %s", t.source, t.destination)
+	}
+
+	return nil
+}
+
+func (s *TemplateSink) UpToDate(ctx context.Context, secrets []*provider.Secret) (bool, error) {
+	for _, t := range s.templates {
+		data, err := Render(t.tmpl, secrets)
+		if err != nil {
+			return false, fmt.Errorf("failed to render template %s: %w", t.source, err)
+		}
+		ok, err := sink.FileUpToDate(t.destination, data)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Render executes tmpl with the given secrets.
+func Render(tmpl *template.Template, secrets []*provider.Secret) ([]byte, error) {
+	byName := make(map[string]*provider.Secret, len(secrets))
+	for _, secret := range secrets {
+		byName[secret.Name] = secret
+	}
+
+	t, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Funcs(funcMap(byName)).Execute(&buf, templateData{Secrets: byName}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// funcMap returns the functions available in templates:
+//
+//	secret NAME [KEY]  value of a secret, or of a key of a JSON secret (empty if the key is missing)
+//	b64enc / b64dec    base64 encoding
+//	toJSON             JSON encoding of any value
+//	default DEF VALUE  DEF if VALUE is empty, e.g. {{ secret "db" "port" | default "5432" }}
+func funcMap(secrets map[string]*provider.Secret) template.FuncMap {
+	return template.FuncMap{
+		"secret": func(name string, key ...string) (string, error) {
+			secret, ok := secrets[name]
+			if !ok {
+				return "", fmt.Errorf("unknown secret %s", name)
+			}
+			if len(key) == 0 {
+				return string(secret.Value), nil
+			}
+
+			data, ok := secret.KeyValues()
+			if !ok {
+				return "", fmt.Errorf("secret %s is not a JSON object", name)
+			}
+			return data[key[0]], nil
+		},
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"b64dec": func(s string) (string, error) {
+			data, err := base64.StdEncoding.DecodeString(s)
+			return string(data), err
+		},
+		"toJSON": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"default": func(def interface{}, value interface{}) interface{} {
+			if value == nil {
+				return def
+			}
+			if s, ok := value.(string); ok && s == "" {
+				return def
+			}
+			return value
+		},
+	}
+}
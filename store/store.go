@@ -0,0 +1,414 @@
+// Package store instantiates the providers described by SecretStores and ClusterSecretStores.
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/v1alpha1"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	"github.com/kvendingoldo/cloud-secrets/provider/aws"
+	"github.com/kvendingoldo/cloud-secrets/provider/azure"
+	"github.com/kvendingoldo/cloud-secrets/provider/google"
+	"github.com/kvendingoldo/cloud-secrets/provider/vault"
+	log "github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// idleTimeout is the time after which unused providers are dropped from the cache and closed
+	idleTimeout = time.Hour
+
+	// tokenExpiration is the lifetime of requested service account tokens
+	tokenExpiration = time.Hour
+	// tokenRequestTimeout bounds requests of service account tokens
+	tokenRequestTimeout = 30 * time.Second
+)
+
+// Manager instantiates the providers of SecretStores and ClusterSecretStores, so one controller serves many accounts.
+// Providers are cached by their configuration including the resolved credentials: stores describing
+// the same account share a provider, and a provider is replaced once the credentials in its Secrets change.
+type Manager struct {
+	client client.Client
+	// defaults holds the settings of the controller which aren't part of stores, e.g. the AWS API retries.
+	// Credentials of the controller are only used by ClusterSecretStores without auth, never by SecretStores.
+	defaults *cloudsecrets.Config
+
+	mu        sync.Mutex
+	providers map[string]*cachedProvider
+}
+
+type cachedProvider struct {
+	provider provider.Provider
+	lastUsed time.Time
+}
+
+func NewManager(c client.Client, defaults *cloudsecrets.Config) *Manager {
+	return &Manager{
+		client:    c,
+		defaults:  defaults,
+		providers: map[string]*cachedProvider{},
+	}
+}
+
+// +kubebuilder:rbac:groups=cloud-secrets.kvendingoldo.io,resources=secretstores;clustersecretstores,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
+
+// Provider returns the provider of the store referenced by ref, namespace is the namespace of the referencing CloudSecret
+func (m *Manager) Provider(ctx context.Context, namespace string, ref v1alpha1.ProviderRef) (provider.Provider, error) {
+	r := &resolver{
+		client:      m.client,
+		defaults:    m.defaults,
+		credentials: map[string]string{},
+	}
+
+	var spec v1alpha1.SecretStoreSpec
+	switch ref.Kind {
+	case v1alpha1.SecretStoreKind:
+		var store v1alpha1.SecretStore
+		if err := m.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, &store); err != nil {
+			return nil, fmt.Errorf("failed to get SecretStore %s: %w", ref.Name, err)
+		}
+		spec = store.Spec
+		r.namespace = namespace
+	case v1alpha1.ClusterSecretStoreKind:
+		var store v1alpha1.ClusterSecretStore
+		if err := m.client.Get(ctx, types.NamespacedName{Name: ref.Name}, &store); err != nil {
+			return nil, fmt.Errorf("failed to get ClusterSecretStore %s: %w", ref.Name, err)
+		}
+		spec = store.Spec
+		r.cluster = true
+	default:
+		return nil, fmt.Errorf("unknown store kind %s", ref.Kind)
+	}
+
+	newProvider, err := r.resolve(ctx, spec.Provider)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", ref.Kind, ref.Name, err)
+	}
+	key, err := r.key(spec.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.evictIdle(now)
+
+	if cached, ok := m.providers[key]; ok {
+		cached.lastUsed = now
+		return cached.provider, nil
+	}
+
+	p, err := newProvider()
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup provider of %s %s: %w", ref.Kind, ref.Name, err)
+	}
+	m.providers[key] = &cachedProvider{provider: p, lastUsed: now}
+	log.Infof("Created provider of %s %s", ref.Kind, ref.Name)
+
+	return p, nil
+}
+
+// evictIdle drops the providers which weren't used within idleTimeout, including providers which were replaced
+// as the credentials of their store changed. Providers holding connections, e.g. of GCP, are closed.
+// The caller must hold mu.
+func (m *Manager) evictIdle(now time.Time) {
+	for k, cached := range m.providers {
+		if now.Sub(cached.lastUsed) <= idleTimeout {
+			continue
+		}
+		delete(m.providers, k)
+		if closer, ok := cached.provider.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Warnf("Failed to close idle provider: %v", err)
+			}
+		}
+	}
+}
+
+// resolver reads the credentials referenced by a store
+type resolver struct {
+	client   client.Client
+	defaults *cloudsecrets.Config
+
+	// namespace of a SecretStore, references can't leave it
+	namespace string
+	// cluster is set for ClusterSecretStores, whose references name their namespace
+	cluster bool
+
+	// credentials read from Secrets, keyed by namespace, name and key of the Secret
+	credentials map[string]string
+}
+
+// key identifies the provider configured by p and the credentials read by the resolver
+func (r *resolver) key(p v1alpha1.StoreProvider) (string, error) {
+	data, err := json.Marshal(struct {
+		Namespace   string
+		Provider    v1alpha1.StoreProvider
+		Credentials map[string]string
+	}{r.namespace, p, r.credentials})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// resolve reads the credentials of p and returns a function creating the provider
+func (r *resolver) resolve(ctx context.Context, p v1alpha1.StoreProvider) (func() (provider.Provider, error), error) {
+	switch {
+	case p.AWS != nil:
+		return r.aws(ctx, p.AWS)
+	case p.Azure != nil:
+		return r.azure(ctx, p.Azure)
+	case p.Google != nil:
+		return r.google(ctx, p.Google)
+	case p.Vault != nil:
+		return r.vault(ctx, p.Vault)
+	default:
+		return nil, errors.New("no provider configured")
+	}
+}
+
+func (r *resolver) aws(ctx context.Context, spec *v1alpha1.AWSStoreProvider) (func() (provider.Provider, error), error) {
+	config := aws.AWSConfig{
+		Region:       spec.Region,
+		AssumeRole:   spec.Role,
+		APIRetries:   r.defaults.AWSAPIRetries,
+		VersionStage: r.defaults.AWSVersionStage,
+	}
+	if spec.VersionStage != "" {
+		config.VersionStage = spec.VersionStage
+	}
+
+	if ref := spec.Auth.SecretRef; ref != nil {
+		var err error
+		if config.AccessKeyID, err = r.secretValue(ctx, ref.AccessKeyID); err != nil {
+			return nil, err
+		}
+		if config.SecretAccessKey, err = r.secretValue(ctx, ref.SecretAccessKey); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Auth.SecretRef == nil && spec.Auth.ServiceAccountRef == nil {
+		if err := r.controllerCredentials(); err != nil {
+			return nil, err
+		}
+	}
+	if ref := spec.Auth.ServiceAccountRef; ref != nil {
+		if spec.Role == "" {
+			return nil, errors.New("a role is required to authenticate with a service account")
+		}
+		token, err := r.serviceAccountToken(ref, "sts.amazonaws.com")
+		if err != nil {
+			return nil, err
+		}
+		config.WebIdentityToken = token
+	}
+
+	if spec.Service == "ParameterStore" {
+		return func() (provider.Provider, error) { return aws.NewSSMProvider(config) }, nil
+	}
+	return func() (provider.Provider, error) { return aws.NewAWSProvider(config) }, nil
+}
+
+func (r *resolver) azure(ctx context.Context, spec *v1alpha1.AzureStoreProvider) (func() (provider.Provider, error), error) {
+	config := azure.AzureConfig{
+		KeyVaults:   spec.KeyVaults,
+		VaultURLs:   spec.VaultURLs,
+		Environment: spec.Environment,
+		AuthMethod:  "managed-identity",
+		TenantID:    spec.TenantID,
+		ClientID:    spec.ClientID,
+	}
+
+	if spec.Auth.ClientSecretRef == nil && spec.Auth.ServiceAccountRef == nil {
+		if err := r.controllerCredentials(); err != nil {
+			return nil, err
+		}
+	}
+	if ref := spec.Auth.ClientSecretRef; ref != nil {
+		secret, err := r.secretValue(ctx, *ref)
+		if err != nil {
+			return nil, err
+		}
+		config.AuthMethod = "client-secret"
+		config.ClientSecret = secret
+	}
+	if ref := spec.Auth.ServiceAccountRef; ref != nil {
+		token, err := r.serviceAccountToken(ref, "api://AzureADTokenExchange")
+		if err != nil {
+			return nil, err
+		}
+		config.AuthMethod = "workload-identity"
+		config.FederatedToken = token
+	}
+
+	return func() (provider.Provider, error) { return azure.NewAzureProvider(config) }, nil
+}
+
+func (r *resolver) google(ctx context.Context, spec *v1alpha1.GoogleStoreProvider) (func() (provider.Provider, error), error) {
+	config := google.GoogleConfig{
+		ProjectId:                 spec.ProjectID,
+		SecretVersion:             r.defaults.GCPSecretVersion,
+		ImpersonateServiceAccount: spec.ImpersonateServiceAccount,
+		FallbackToEnabled:         r.defaults.GCPVersionFallback,
+	}
+
+	if ref := spec.Auth.SecretRef; ref != nil {
+		credentials, err := r.secretValue(ctx, *ref)
+		if err != nil {
+			return nil, err
+		}
+		config.CredentialsJSON = []byte(credentials)
+	} else if err := r.controllerCredentials(); err != nil {
+		return nil, err
+	}
+
+	return func() (provider.Provider, error) { return google.NewGoogleProvider(config) }, nil
+}
+
+func (r *resolver) vault(ctx context.Context, spec *v1alpha1.VaultStoreProvider) (func() (provider.Provider, error), error) {
+	config := vault.VaultConfig{
+		Address:       spec.Server,
+		Namespace:     spec.Namespace,
+		MountPath:     r.defaults.VaultMountPath,
+		KVVersion:     r.defaults.VaultKVVersion,
+		SecretVersion: r.defaults.VaultSecretVersion,
+	}
+	if spec.MountPath != "" {
+		config.MountPath = spec.MountPath
+	}
+	if spec.KVVersion != 0 {
+		config.KVVersion = spec.KVVersion
+	}
+
+	// The service account token is requested on every login, the provider logs in again before its token expires
+	auth := spec.Auth
+	switch {
+	case auth.TokenSecretRef != nil:
+		value, err := r.secretValue(ctx, *auth.TokenSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		config.AuthMethod = "token"
+		config.Token = value
+	case auth.AppRole != nil:
+		secretID, err := r.secretValue(ctx, auth.AppRole.SecretRef)
+		if err != nil {
+			return nil, err
+		}
+		config.AuthMethod = "approle"
+		config.AuthMountPath = auth.AppRole.MountPath
+		config.RoleID = auth.AppRole.RoleID
+		config.SecretID = secretID
+	case auth.Kubernetes != nil:
+		config.AuthMethod = "kubernetes"
+		config.AuthMountPath = auth.Kubernetes.MountPath
+		config.Role = auth.Kubernetes.Role
+		if ref := auth.Kubernetes.ServiceAccountRef; ref != nil {
+			token, err := r.serviceAccountToken(ref)
+			if err != nil {
+				return nil, err
+			}
+			config.JWT = token
+		} else if err := r.controllerCredentials(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("no vault auth method configured")
+	}
+
+	return func() (provider.Provider, error) { return vault.NewVaultProvider(config) }, nil
+}
+
+// controllerCredentials returns an error unless the store may use the credentials of the controller.
+// Only ClusterSecretStores may, otherwise every namespace could read the secrets the controller has access to.
+func (r *resolver) controllerCredentials() error {
+	if r.cluster {
+		return nil
+	}
+	return errors.New("SecretStores require auth, the credentials of the controller are only used by ClusterSecretStores")
+}
+
+// refNamespace returns the namespace of a referenced object.
+// References of SecretStores can't leave their namespace, references of ClusterSecretStores must name one.
+func (r *resolver) refNamespace(namespace string) (string, error) {
+	if r.cluster {
+		if namespace == "" {
+			return "", errors.New("references of ClusterSecretStores require a namespace")
+		}
+		return namespace, nil
+	}
+	if namespace != "" && namespace != r.namespace {
+		return "", fmt.Errorf("references of SecretStores can't leave namespace %s", r.namespace)
+	}
+	return r.namespace, nil
+}
+
+// secretValue reads a key of a Secret, empty values are rejected so the environment of the controller isn't used instead
+func (r *resolver) secretValue(ctx context.Context, sel v1alpha1.SecretKeySelector) (string, error) {
+	namespace, err := r.refNamespace(sel.Namespace)
+	if err != nil {
+		return "", err
+	}
+
+	var secret corev1.Secret
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: sel.Name}, &secret); err != nil {
+		return "", fmt.Errorf("failed to get secret %s/%s: %w", namespace, sel.Name, err)
+	}
+	value := secret.Data[sel.Key]
+	if len(value) == 0 {
+		return "", fmt.Errorf("secret %s/%s has no key %s", namespace, sel.Name, sel.Key)
+	}
+
+	r.credentials[namespace+"/"+sel.Name+"/"+sel.Key] = string(value)
+	return string(value), nil
+}
+
+// serviceAccountToken returns a function requesting tokens of a service account.
+// defaultAudiences are used if the reference doesn't name audiences.
+func (r *resolver) serviceAccountToken(sel *v1alpha1.ServiceAccountSelector, defaultAudiences ...string) (func() (string, error), error) {
+	namespace, err := r.refNamespace(sel.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	audiences := sel.Audiences
+	if len(audiences) == 0 {
+		audiences = defaultAudiences
+	}
+
+	c := r.client
+	return func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), tokenRequestTimeout)
+		defer cancel()
+
+		expiration := int64(tokenExpiration.Seconds())
+		serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: sel.Name, Namespace: namespace}}
+		request := &authenticationv1.TokenRequest{
+			Spec: authenticationv1.TokenRequestSpec{
+				Audiences:         audiences,
+				ExpirationSeconds: &expiration,
+			},
+		}
+		if err := c.SubResource("token").Create(ctx, serviceAccount, request); err != nil {
+			return "", fmt.Errorf("failed to request token of service account %s/%s: %w", namespace, sel.Name, err)
+		}
+		return request.Status.Token, nil
+	}, nil
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kvendingoldo/cloud-secrets/internal/fixtures"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets"
+	"github.com/kvendingoldo/cloud-secrets/pkg/apis/cloudsecrets/v1alpha1"
+	"github.com/kvendingoldo/cloud-secrets/provider"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestManager(t *testing.T, objects ...client.Object) (*Manager, client.Client) {
+	t.Helper()
+	c := fixtures.NewClientBuilder(t).WithObjects(objects...).Build()
+	defaults := &cloudsecrets.Config{VaultMountPath: "secret", VaultKVVersion: 2}
+	return NewManager(c, defaults), c
+}
+
+func secretStore(name string, p v1alpha1.StoreProvider) *v1alpha1.SecretStore {
+	return &v1alpha1.SecretStore{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "apps"},
+		Spec:       v1alpha1.SecretStoreSpec{Provider: p},
+	}
+}
+
+func clusterSecretStore(name string, p v1alpha1.StoreProvider) *v1alpha1.ClusterSecretStore {
+	return &v1alpha1.ClusterSecretStore{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1alpha1.SecretStoreSpec{Provider: p},
+	}
+}
+
+func TestSecretStoresRequireAuth(t *testing.T) {
+	stores := []*v1alpha1.SecretStore{
+		secretStore("aws", v1alpha1.StoreProvider{AWS: &v1alpha1.AWSStoreProvider{Region: "eu-west-1"}}),
+		secretStore("aws-role", v1alpha1.StoreProvider{AWS: &v1alpha1.AWSStoreProvider{Region: "eu-west-1", Role: "arn:aws:iam::123456789012:role/prod"}}),
+		secretStore("azure", v1alpha1.StoreProvider{Azure: &v1alpha1.AzureStoreProvider{KeyVaults: []string{"prod"}, ClientID: "client"}}),
+		secretStore("google", v1alpha1.StoreProvider{Google: &v1alpha1.GoogleStoreProvider{ProjectID: "prod", ImpersonateServiceAccount: "sa@prod.iam.gserviceaccount.com"}}),
+		secretStore("vault", v1alpha1.StoreProvider{Vault: &v1alpha1.VaultStoreProvider{
+			Server: "https://vault.example.com",
+			Auth:   v1alpha1.VaultAuth{Kubernetes: &v1alpha1.VaultKubernetesAuth{Role: "admin"}},
+		}}),
+	}
+	var objects []client.Object
+	for _, store := range stores {
+		objects = append(objects, store)
+	}
+	m, _ := newTestManager(t, objects...)
+
+	for _, store := range stores {
+		_, err := m.Provider(context.Background(), "apps", v1alpha1.ProviderRef{Kind: v1alpha1.SecretStoreKind, Name: store.Name})
+		if err == nil || !strings.Contains(err.Error(), "SecretStores require auth") {
+			t.Errorf("%s: expected auth error, got %v", store.Name, err)
+		}
+	}
+}
+
+func TestClusterSecretStoreControllerCredentials(t *testing.T) {
+	m, _ := newTestManager(t,
+		clusterSecretStore("aws", v1alpha1.StoreProvider{AWS: &v1alpha1.AWSStoreProvider{Region: "eu-west-1"}}),
+	)
+
+	if _, err := m.Provider(context.Background(), "apps", v1alpha1.ProviderRef{Kind: v1alpha1.ClusterSecretStoreKind, Name: "aws"}); err != nil {
+		t.Errorf("ClusterSecretStore without auth failed: %v", err)
+	}
+}
+
+func TestSecretStoreToken(t *testing.T) {
+	vault := fixtures.NewVault(t, "s.tenant")
+	vault.Set("secret/db", map[string]string{"password": "hunter2"})
+	m, c := newTestManager(t,
+		secretStore("vault", v1alpha1.StoreProvider{Vault: &v1alpha1.VaultStoreProvider{
+			Server: vault.URL,
+			Auth:   v1alpha1.VaultAuth{TokenSecretRef: &v1alpha1.SecretKeySelector{Name: "vault", Key: "token"}},
+		}}),
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault", Namespace: "apps"},
+			Data:       map[string][]byte{"token": []byte("s.tenant")},
+		},
+	)
+	ref := v1alpha1.ProviderRef{Kind: v1alpha1.SecretStoreKind, Name: "vault"}
+
+	p, err := m.Provider(context.Background(), "apps", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := p.GetSecret(context.Background(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Value) != `{"password":"hunter2"}` {
+		t.Errorf("value = %s", secret.Value)
+	}
+
+	cached, err := m.Provider(context.Background(), "apps", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != p {
+		t.Error("provider wasn't cached")
+	}
+
+	// Changed credentials replace the provider
+	var token corev1.Secret
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "apps", Name: "vault"}, &token); err != nil {
+		t.Fatal(err)
+	}
+	token.Data["token"] = []byte("s.rotated")
+	if err := c.Update(context.Background(), &token); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := m.Provider(context.Background(), "apps", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == p {
+		t.Error("provider wasn't replaced after the credentials changed")
+	}
+}
+
+func TestSecretStoreReferencesStayInNamespace(t *testing.T) {
+	m, _ := newTestManager(t,
+		secretStore("vault", v1alpha1.StoreProvider{Vault: &v1alpha1.VaultStoreProvider{
+			Server: "https://vault.example.com",
+			Auth:   v1alpha1.VaultAuth{TokenSecretRef: &v1alpha1.SecretKeySelector{Name: "vault", Namespace: "kube-system", Key: "token"}},
+		}}),
+	)
+
+	_, err := m.Provider(context.Background(), "apps", v1alpha1.ProviderRef{Kind: v1alpha1.SecretStoreKind, Name: "vault"})
+	if err == nil || !strings.Contains(err.Error(), "can't leave namespace apps") {
+		t.Errorf("expected namespace error, got %v", err)
+	}
+}
+
+// closingProvider records whether it was closed
+type closingProvider struct {
+	provider.BaseProvider
+	closed bool
+}
+
+func (p *closingProvider) GetSecret(ctx context.Context, name string) (*provider.Secret, error) {
+	return nil, nil
+}
+
+func (p *closingProvider) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestIdleProvidersAreClosed(t *testing.T) {
+	m, _ := newTestManager(t,
+		clusterSecretStore("aws", v1alpha1.StoreProvider{AWS: &v1alpha1.AWSStoreProvider{Region: "eu-west-1"}}),
+	)
+	idle := &closingProvider{}
+	active := &closingProvider{}
+	m.providers["idle"] = &cachedProvider{provider: idle, lastUsed: time.Now().Add(-idleTimeout - time.Minute)}
+	m.providers["active"] = &cachedProvider{provider: active, lastUsed: time.Now()}
+
+	if _, err := m.Provider(context.Background(), "apps", v1alpha1.ProviderRef{Kind: v1alpha1.ClusterSecretStoreKind, Name: "aws"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.providers["idle"]; ok || !idle.closed {
+		t.Errorf("idle provider wasn't evicted and closed: cached %v, closed %v", ok, idle.closed)
+	}
+	if _, ok := m.providers["active"]; !ok || active.closed {
+		t.Errorf("active provider was evicted: cached %v, closed %v", ok, active.closed)
+	}
+}
@@ -0,0 +1,205 @@
+// Package webhook implements the mutating admission webhook injecting secrets into pods.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Path is the path the webhook is served on
+const Path = "/mutate-v1-pod"
+
+// LabelInject marks pods requesting secrets. The webhook is only called for pods with the label,
+// so it can fail closed without blocking other pods.
+const LabelInject = "cloud-secrets.kvendingoldo.io/inject"
+
+// Annotations of pods requesting secrets, e.g.
+//
+//	metadata:
+//	  labels:
+//	    cloud-secrets.kvendingoldo.io/inject: "true"
+//	  annotations:
+//	    cloud-secrets.kvendingoldo.io/secrets: "db-password,api-key"
+const (
+	// AnnotationSecrets lists the names of the secrets, separated by commas
+	AnnotationSecrets = "cloud-secrets.kvendingoldo.io/secrets"
+	// AnnotationRefresh adds a sidecar which keeps the secrets up to date
+	AnnotationRefresh = "cloud-secrets.kvendingoldo.io/refresh"
+	// AnnotationRefreshInterval overrides the interval of the sidecar, e.g. 5m
+	AnnotationRefreshInterval = "cloud-secrets.kvendingoldo.io/refresh-interval"
+	// AnnotationInjected marks mutated pods, so they are never mutated twice
+	AnnotationInjected = "cloud-secrets.kvendingoldo.io/injected"
+)
+
+const (
+	VolumeName        = "cloud-secrets"
+	InitContainerName = "cloud-secrets-init"
+	SidecarName       = "cloud-secrets"
+
+	// FileName of the dotenv file holding the secrets in the volume
+	FileName = "secrets.env"
+)
+
+// PodInjector mutates pods labeled with LabelInject and annotated with secret references. It adds an in-memory volume,
+// mounted read-only into all containers, and an init container writing the secrets into it,
+// so they are available before any other container starts. On request a sidecar refreshes them. The sidecar is
+// a native sidecar, an init container with restartPolicy Always, so it doesn't keep Jobs from completing.
+// Native sidecars require Kubernetes 1.29 or later.
+//
+// The injected containers run cloud-secrets with the service account of the pod,
+// so the provider has to accept it, e.g. through IRSA, workload identity or Vault kubernetes auth.
+type PodInjector struct {
+	// Image of the injected containers
+	Image string
+	// MountPath of the volume in all containers
+	MountPath string
+	// ProviderArgs configure the provider of the injected containers
+	ProviderArgs []string
+}
+
+// Pods requesting secrets must not start without them, so failures reject the pods. The objectSelector
+// on LabelInject, added by the kustomization in config/webhook, keeps the webhook away from other pods.
+// +kubebuilder:webhook:path=/mutate-v1-pod,mutating=true,failurePolicy=fail,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=inject.cloud-secrets.kvendingoldo.io,admissionReviewVersions=v1,reinvocationPolicy=IfNeeded
+
+func (i *PodInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	var pod corev1.Pod
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if pod.Labels[LabelInject] != "true" {
+		return admission.Allowed("injection not requested")
+	}
+	if pod.Annotations[AnnotationInjected] == "true" {
+		return admission.Allowed("already injected")
+	}
+
+	if err := i.Inject(&pod); err != nil {
+		log.Warnf("Rejected pod %s/%s: %v", req.Namespace, podName(&pod), err)
+		return admission.Denied(err.Error())
+	}
+
+	mutated, err := json.Marshal(&pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	log.Infof("Injected secrets into pod %s/%s", req.Namespace, podName(&pod))
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, mutated)
+}
+
+// Inject adds the volume and the containers requested by the annotations to pod
+func (i *PodInjector) Inject(pod *corev1.Pod) error {
+	var names []string
+	for _, name := range strings.Split(pod.Annotations[AnnotationSecrets], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("annotation %s lists no secrets", AnnotationSecrets)
+	}
+
+	interval := pod.Annotations[AnnotationRefreshInterval]
+	if interval != "" {
+		if _, err := time.ParseDuration(interval); err != nil {
+			return fmt.Errorf("invalid annotation %s: %w", AnnotationRefreshInterval, err)
+		}
+	}
+
+	for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if c.Name == InitContainerName || c.Name == SidecarName {
+			return fmt.Errorf("container name %s is reserved", c.Name)
+		}
+	}
+
+	args := append([]string{}, i.ProviderArgs...)
+	args = append(args,
+		"--sink", "dotenv",
+		"--dotenv-path", path.Join(i.MountPath, FileName),
+		// Containers of the pod may run as different users, the volume isn't shared beyond the pod
+		"--dotenv-file-mode", "0644",
+	)
+	for _, name := range names {
+		args = append(args, "--secret-name", name)
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: VolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+		},
+	})
+	readOnly := corev1.VolumeMount{Name: VolumeName, MountPath: i.MountPath, ReadOnly: true}
+	for idx := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[idx].VolumeMounts = append(pod.Spec.InitContainers[idx].VolumeMounts, readOnly)
+	}
+	for idx := range pod.Spec.Containers {
+		pod.Spec.Containers[idx].VolumeMounts = append(pod.Spec.Containers[idx].VolumeMounts, readOnly)
+	}
+
+	// The init container runs first, so the other init containers can use the secrets as well.
+	// The sidecar starts right after it and keeps running until the other containers terminate.
+	injected := []corev1.Container{i.container(InitContainerName, args, "--once")}
+	if pod.Annotations[AnnotationRefresh] == "true" {
+		extra := []string{"--no-once"}
+		if interval != "" {
+			extra = append(extra, "--interval", interval)
+		}
+		sidecar := i.container(SidecarName, args, extra...)
+		always := corev1.ContainerRestartPolicyAlways
+		sidecar.RestartPolicy = &always
+		injected = append(injected, sidecar)
+	}
+	pod.Spec.InitContainers = append(injected, pod.Spec.InitContainers...)
+
+	pod.Annotations[AnnotationInjected] = "true"
+	return nil
+}
+
+// container returns an injected container running cloud-secrets with args and extra. It satisfies
+// the restricted Pod Security Standard, so the webhook can inject it into pods of any namespace.
+func (i *PodInjector) container(name string, args []string, extra ...string) corev1.Container {
+	yes, no := true, false
+	return corev1.Container{
+		Name:  name,
+		Image: i.Image,
+		Args:  append(append([]string{}, args...), extra...),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: VolumeName, MountPath: i.MountPath},
+		},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			RunAsNonRoot:             &yes,
+			AllowPrivilegeEscalation: &no,
+			ReadOnlyRootFilesystem:   &yes,
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+			SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		},
+	}
+}
+
+// podName returns the name of pod, pods of controllers only have a generated name prefix on admission
+func podName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return pod.GenerateName + "*"
+}
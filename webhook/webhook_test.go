@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newInjector() *PodInjector {
+	return &PodInjector{
+		Image:        "cloud-secrets:test",
+		MountPath:    "/var/run/secrets/cloud-secrets",
+		ProviderArgs: []string{"--provider", "aws", "--aws-region", "eu-west-1"},
+	}
+}
+
+func newPod(labels, annotations map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Labels: labels, Annotations: annotations},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "migrate", Image: "migrate"}},
+			Containers: []corev1.Container{{
+				Name:         "app",
+				Image:        "app",
+				VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+			}},
+		},
+	}
+}
+
+var injectLabels = map[string]string{LabelInject: "true"}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name        string
+		pod         *corev1.Pod
+		wantAllowed bool
+		wantPatches bool
+		wantMessage string
+	}{
+		{
+			name:        "not labeled",
+			pod:         newPod(nil, map[string]string{AnnotationSecrets: "db"}),
+			wantAllowed: true,
+			wantMessage: "injection not requested",
+		},
+		{
+			name:        "already injected",
+			pod:         newPod(injectLabels, map[string]string{AnnotationSecrets: "db", AnnotationInjected: "true"}),
+			wantAllowed: true,
+			wantMessage: "already injected",
+		},
+		{
+			name:        "injected",
+			pod:         newPod(injectLabels, map[string]string{AnnotationSecrets: "db"}),
+			wantAllowed: true,
+			wantPatches: true,
+		},
+		{
+			name:        "no secrets",
+			pod:         newPod(injectLabels, map[string]string{AnnotationSecrets: " , "}),
+			wantMessage: "lists no secrets",
+		},
+		{
+			name:        "bad refresh interval",
+			pod:         newPod(injectLabels, map[string]string{AnnotationSecrets: "db", AnnotationRefresh: "true", AnnotationRefreshInterval: "5 minutes"}),
+			wantMessage: "invalid annotation " + AnnotationRefreshInterval,
+		},
+		{
+			name: "reserved init container name",
+			pod: func() *corev1.Pod {
+				pod := newPod(injectLabels, map[string]string{AnnotationSecrets: "db"})
+				pod.Spec.InitContainers[0].Name = InitContainerName
+				return pod
+			}(),
+			wantMessage: "container name " + InitContainerName + " is reserved",
+		},
+		{
+			name: "reserved container name",
+			pod: func() *corev1.Pod {
+				pod := newPod(injectLabels, map[string]string{AnnotationSecrets: "db"})
+				pod.Spec.Containers[0].Name = SidecarName
+				return pod
+			}(),
+			wantMessage: "container name " + SidecarName + " is reserved",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(tt.pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := newInjector().Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Namespace: "apps",
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+
+			if resp.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %v, want %v: %v", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+			if (len(resp.Patches) > 0) != tt.wantPatches {
+				t.Errorf("patches = %v", resp.Patches)
+			}
+			if tt.wantMessage != "" && (resp.Result == nil || !strings.Contains(resp.Result.Message, tt.wantMessage)) {
+				t.Errorf("result = %v, want message %q", resp.Result, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestHandleInvalidObject(t *testing.T) {
+	resp := newInjector().Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Object: runtime.RawExtension{Raw: []byte("{")},
+	}})
+	if resp.Allowed || resp.Result.Code != 400 {
+		t.Errorf("result = %v", resp.Result)
+	}
+}
+
+func TestInjectMounts(t *testing.T) {
+	i := newInjector()
+	pod := newPod(injectLabels, map[string]string{AnnotationSecrets: "db"})
+	if err := i.Inject(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	if pod.Annotations[AnnotationInjected] != "true" {
+		t.Errorf("annotations = %v", pod.Annotations)
+	}
+
+	volume := pod.Spec.Volumes[len(pod.Spec.Volumes)-1]
+	if volume.Name != VolumeName || volume.EmptyDir == nil || volume.EmptyDir.Medium != corev1.StorageMediumMemory {
+		t.Errorf("volume = %+v", volume)
+	}
+
+	readOnly := corev1.VolumeMount{Name: VolumeName, MountPath: i.MountPath, ReadOnly: true}
+	if got := pod.Spec.InitContainers[1]; got.Name != "migrate" || !reflect.DeepEqual(got.VolumeMounts, []corev1.VolumeMount{readOnly}) {
+		t.Errorf("init container = %+v", got)
+	}
+	want := []corev1.VolumeMount{{Name: "data", MountPath: "/data"}, readOnly}
+	if got := pod.Spec.Containers[0]; !reflect.DeepEqual(got.VolumeMounts, want) {
+		t.Errorf("volume mounts = %+v, want %+v", got.VolumeMounts, want)
+	}
+
+	if len(pod.Spec.InitContainers) != 2 || pod.Spec.InitContainers[0].Name != InitContainerName {
+		t.Fatalf("init containers = %+v", pod.Spec.InitContainers)
+	}
+	init := pod.Spec.InitContainers[0]
+	if init.Image != i.Image || !reflect.DeepEqual(init.VolumeMounts, []corev1.VolumeMount{{Name: VolumeName, MountPath: i.MountPath}}) {
+		t.Errorf("init container = %+v", init)
+	}
+	if sc := init.SecurityContext; sc == nil || !*sc.RunAsNonRoot || *sc.AllowPrivilegeEscalation ||
+		!reflect.DeepEqual(sc.Capabilities.Drop, []corev1.Capability{"ALL"}) {
+		t.Errorf("security context = %+v", init.SecurityContext)
+	}
+	if init.Resources.Requests.Memory().IsZero() || init.Resources.Limits.Memory().IsZero() {
+		t.Errorf("resources = %+v", init.Resources)
+	}
+	if init.RestartPolicy != nil {
+		t.Errorf("init container restart policy = %v", *init.RestartPolicy)
+	}
+	if len(pod.Spec.Containers) != 1 {
+		t.Errorf("sidecar added without refresh: %+v", pod.Spec.Containers)
+	}
+}
+
+func TestInjectNativeSidecar(t *testing.T) {
+	pod := newPod(injectLabels, map[string]string{AnnotationSecrets: "db", AnnotationRefresh: "true"})
+	if err := newInjector().Inject(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, c := range pod.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	if want := []string{InitContainerName, SidecarName, "migrate"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("init containers = %v, want %v", names, want)
+	}
+	sidecar := pod.Spec.InitContainers[1]
+	if sidecar.RestartPolicy == nil || *sidecar.RestartPolicy != corev1.ContainerRestartPolicyAlways {
+		t.Errorf("sidecar restart policy = %v", sidecar.RestartPolicy)
+	}
+	if sidecar.SecurityContext == nil || !*sidecar.SecurityContext.RunAsNonRoot {
+		t.Errorf("sidecar security context = %+v", sidecar.SecurityContext)
+	}
+	if len(pod.Spec.Containers) != 1 {
+		t.Errorf("containers = %+v", pod.Spec.Containers)
+	}
+}
+
+func TestInjectArgs(t *testing.T) {
+	common := []string{
+		"--provider", "aws", "--aws-region", "eu-west-1",
+		"--sink", "dotenv",
+		"--dotenv-path", "/var/run/secrets/cloud-secrets/secrets.env",
+		"--dotenv-file-mode", "0644",
+		"--secret-name", "db", "--secret-name", "api-key",
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantSidecar []string
+	}{
+		{
+			name:        "without refresh",
+			annotations: map[string]string{AnnotationSecrets: "db, api-key"},
+		},
+		{
+			name:        "refresh",
+			annotations: map[string]string{AnnotationSecrets: "db,api-key", AnnotationRefresh: "true"},
+			wantSidecar: append(append([]string{}, common...), "--no-once"),
+		},
+		{
+			name:        "refresh interval",
+			annotations: map[string]string{AnnotationSecrets: "db,api-key", AnnotationRefresh: "true", AnnotationRefreshInterval: "5m"},
+			wantSidecar: append(append([]string{}, common...), "--no-once", "--interval", "5m"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newPod(injectLabels, tt.annotations)
+			if err := newInjector().Inject(pod); err != nil {
+				t.Fatal(err)
+			}
+
+			wantInit := append(append([]string{}, common...), "--once")
+			if got := pod.Spec.InitContainers[0].Args; !reflect.DeepEqual(got, wantInit) {
+				t.Errorf("init args = %v, want %v", got, wantInit)
+			}
+
+			var sidecar []string
+			for _, c := range pod.Spec.InitContainers {
+				if c.Name == SidecarName {
+					sidecar = c.Args
+				}
+			}
+			if !reflect.DeepEqual(sidecar, tt.wantSidecar) {
+				t.Errorf("sidecar args = %v, want %v", sidecar, tt.wantSidecar)
+			}
+		})
+	}
+}